@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go-learning-demo/real_world_practices/internal/bucket"
+)
+
+/*
+🚰 总带宽上限
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+限制了 worker 数量，还是可能把网络跑满：3 个 worker 同时下大文件，
+别的程序就没带宽用了。
+
+所有 worker 共用一个 bandwidthLimiter（令牌桶，1 个令牌 = 1 字节）：
+每下载 n 个字节先拿 n 个令牌，worker 再多，加起来也不会超过上限。
+
+💡 完整版在 02_rate_limiter（TokenBucket + rate_limited_io.go 的 Reader），
+两个目录都是独立的 main 包，没法互相引用，
+所以补令牌的算法放在 real_world_practices/internal/bucket，两边共用，这里只加了锁和分块等待。
+*/
+
+// bandwidthLimiter 多个 worker 共享的带宽上限
+type bandwidthLimiter struct {
+	mu    sync.Mutex
+	state bucket.State // 每个令牌 = 1 字节，容量就是一次最多发放多少字节
+}
+
+// newBandwidthLimiter 创建带宽上限，bytesPerSecond <= 0 时返回 nil，表示不限速
+func newBandwidthLimiter(bytesPerSecond int, burst int) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	interval := time.Second / time.Duration(bytesPerSecond)
+	if interval <= 0 {
+		interval = 1 // 超过每纳秒 1 字节，相当于不限速
+	}
+	return &bandwidthLimiter{state: bucket.New(interval, burst, time.Now())}
+}
+
+// wait 为 n 个字节拿令牌，done 关闭时放弃并返回 false
+// n 比桶的容量大时分成几块依次拿，所以多个 worker 会轮流拿到带宽
+func (bl *bandwidthLimiter) wait(n int, done <-chan struct{}) bool {
+	if bl == nil {
+		return true
+	}
+
+	for n > 0 {
+		chunk := n
+		if chunk > bl.state.Capacity {
+			chunk = bl.state.Capacity
+		}
+
+		bl.mu.Lock()
+		bl.state.Refill(time.Now())
+		if bl.state.Tokens >= float64(chunk) {
+			bl.state.Tokens -= float64(chunk)
+			bl.mu.Unlock()
+			n -= chunk
+			continue
+		}
+		delay := bl.state.Delay(chunk)
+		bl.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiterSharedAcrossWorkers(t *testing.T) {
+	bandwidth := newBandwidthLimiter(100*1024, 10*1024) // 100KB/s，突发 10KB
+	done := make(chan struct{})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < 3; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !bandwidth.wait(10*1024, done) {
+				t.Error("没有取消却返回了 false")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 3 个 worker 一共 30KB：突发的 10KB 立即可用，剩下 20KB 需要大约 200ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("30KB 只用了 %v，总带宽没有被限制", elapsed)
+	}
+}
+
+func TestBandwidthLimiterCancel(t *testing.T) {
+	bandwidth := newBandwidthLimiter(1024, 1024)
+	bandwidth.wait(1024, nil) // 用掉突发，下一次要等 1 秒
+
+	done := make(chan struct{})
+	time.AfterFunc(20*time.Millisecond, func() { close(done) })
+
+	start := time.Now()
+	if bandwidth.wait(1024, done) {
+		t.Error("取消之后应该返回 false")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("取消后过了 %v 才返回", elapsed)
+	}
+}
+
+func TestBandwidthLimiterNilMeansUnlimited(t *testing.T) {
+	bandwidth := newBandwidthLimiter(0, 0)
+	if bandwidth != nil {
+		t.Fatal("带宽为 0 时应该返回 nil（不限速）")
+	}
+	if !bandwidth.wait(1<<30, nil) {
+		t.Error("不限速时 wait 应该立即返回 true")
+	}
+}
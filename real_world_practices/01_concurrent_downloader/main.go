@@ -46,7 +46,8 @@ type DownloadResult struct {
 	Success  bool
 	Error    string
 	Duration time.Duration
-	Timeout  bool // 标记是否超时
+	Timeout  bool  // 标记是否超时
+	Bytes    int64 // 实际下载的字节数（solution.go 的带宽上限会用到）
 }
 
 // simulateDownload 模拟下载过程（实际项目中这里会是真实的 HTTP 请求）
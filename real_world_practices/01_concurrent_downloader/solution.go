@@ -10,29 +10,50 @@ import (
 // 类型定义（File、DownloadResult、simulateDownload）在 main.go 中
 // 这里只包含实现逻辑
 
+// fileSize 模拟的文件大小（16KB ~ 64KB）
+func fileSize(file File) int {
+	return (file.ID%4 + 1) * 16 * 1024
+}
+
 // simulateDownloadWithCancel 模拟可取消的下载
 // 会定期检查 done channel，如果关闭了就提前返回
-func simulateDownloadWithCancel(file File, done chan struct{}) DownloadResult {
+// bandwidth 是所有 worker 共享的带宽上限，为 nil 表示不限速
+func simulateDownloadWithCancel(file File, done chan struct{}, bandwidth *bandwidthLimiter) DownloadResult {
 	// 模拟下载分成多个步骤，每个步骤检查是否取消
 	steps := 5                             // 假设下载分 5 个步骤
-	stepDuration := 100 * time.Millisecond // 每步耗时 100ms
+	stepDuration := 100 * time.Millisecond // 每步至少耗时 100ms（网络延迟）
+	chunk := fileSize(file) / steps        // 每步下载的字节数
 
+	start := time.Now()
 	for i := 0; i < steps; i++ {
-		// 检查是否收到取消信号
-		select {
-		case <-done:
+		stepStart := time.Now()
+
+		// 先拿到这一步的带宽令牌，等待期间收到取消信号就放弃
+		cancelled := !bandwidth.wait(chunk, done)
+		if !cancelled {
+			// 检查是否收到取消信号
+			select {
+			case <-done:
+				cancelled = true
+			default:
+				// 继续执行：带宽够快时，这一步的耗时由网络延迟决定
+				if rest := stepDuration - time.Since(stepStart); rest > 0 {
+					time.Sleep(rest)
+				}
+			}
+		}
+
+		if cancelled {
 			// 收到取消信号，立即返回
 			return DownloadResult{
 				FileID:   file.ID,
 				FileName: file.Name,
 				Success:  false,
 				Error:    "下载被取消",
-				Duration: time.Duration(i) * stepDuration,
+				Duration: time.Since(start),
 				Timeout:  true,
+				Bytes:    int64(i * chunk),
 			}
-		default:
-			// 继续执行
-			time.Sleep(stepDuration)
 		}
 	}
 
@@ -52,7 +73,8 @@ func simulateDownloadWithCancel(file File, done chan struct{}) DownloadResult {
 			}
 			return ""
 		}(),
-		Duration: time.Duration(steps) * stepDuration,
+		Duration: time.Since(start),
+		Bytes:    int64(steps * chunk),
 	}
 }
 
@@ -77,6 +99,10 @@ func runSolution() {
 
 	const maxWorkers = 3
 	const downloadTimeout = 600 * time.Millisecond // 超时时间设置为 600ms
+	const maxBandwidth = 384 * 1024                // 所有 worker 共享的总带宽（字节/秒），0 表示不限速
+
+	// 🔹 所有 worker 共用一个带宽上限（见 bandwidth.go），worker 再多总速度也不会超过它
+	bandwidth := newBandwidthLimiter(maxBandwidth, 16*1024)
 
 	startTime := time.Now()
 
@@ -106,7 +132,7 @@ func runSolution() {
 				// 启动 goroutine 执行下载
 				go func(f File, doneCh chan struct{}) {
 					// 模拟下载过程，但会检查取消信号
-					result := simulateDownloadWithCancel(f, doneCh)
+					result := simulateDownloadWithCancel(f, doneCh, bandwidth)
 
 					// 检查是否被取消
 					select {
@@ -165,10 +191,12 @@ func runSolution() {
 	successCount := 0
 	failCount := 0
 	timeoutCount := 0
+	var totalBytes int64
 
 	// 从 results 读取所有结果
 	// 当 results 被关闭且清空后，range 循环会自动退出
 	for result := range results {
+		totalBytes += result.Bytes
 		if result.Timeout {
 			// 超时的情况
 			fmt.Printf("❌ [超时] %s (耗时: %v)\n",
@@ -201,6 +229,8 @@ func runSolution() {
 	fmt.Printf("❌ 失败: %d\n", failCount)
 	fmt.Printf("⏰ 超时: %d\n", timeoutCount)
 	fmt.Printf("⏱️  总耗时: %.2fs\n", totalTime.Seconds())
+	fmt.Printf("📦 共下载: %dKB，平均 %.0fKB/s（上限 %dKB/s）\n",
+		totalBytes/1024, float64(totalBytes)/1024/totalTime.Seconds(), maxBandwidth/1024)
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
 	// 💡 性能分析
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+📈 自适应限流器 (AIMD)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+很多第三方 API 不会告诉你它的限额是多少，只会在超限时返回 429。
+这时可以借鉴 TCP 拥塞控制的 AIMD 策略自己"摸索"出合适的速率：
+
+- 加性增 (Additive Increase):      调用成功，就慢慢提高速率
+- 乘性减 (Multiplicative Decrease): 被限流（429）或延迟超标，就把速率砍掉一截
+
+速率会在真实限额附近呈"锯齿形"收敛：慢慢爬升 → 撞到限额 → 砍半 → 再爬升。
+
+🔨 实现思路:
+1. 内部包一个 TokenBucket，真正的限速还是由它完成
+2. 调用方在每次请求结束后通过 Success / Throttled 反馈结果
+3. 根据反馈计算新速率，调用 TokenBucket.SetRate 立即生效
+4. 两次减速之间有冷却时间，避免同一批在途请求的 429 把速率连续砍好几次
+*/
+
+// AdaptiveConfig 自适应限流配置
+type AdaptiveConfig struct {
+	InitialRate    float64       // 初始速率（每秒请求数）
+	MinRate        float64       // 速率下限
+	MaxRate        float64       // 速率上限
+	Increase       float64       // 持续成功时，每秒大约提高多少速率
+	DecreaseFactor float64       // 被限流时速率乘以这个系数（0~1，比如 0.5 表示砍半）
+	LatencyTarget  time.Duration // 延迟超过这个值也视为拥塞（0 表示不看延迟）
+	Cooldown       time.Duration // 两次减速之间的最小间隔
+}
+
+// DefaultAdaptiveConfig 默认配置
+var DefaultAdaptiveConfig = AdaptiveConfig{
+	InitialRate:    5,
+	MinRate:        1,
+	MaxRate:        100,
+	Increase:       1,
+	DecreaseFactor: 0.5,
+	LatencyTarget:  0,
+	Cooldown:       time.Second,
+}
+
+// AdaptiveLimiter 根据下游反馈自动调整速率的限流器
+type AdaptiveLimiter struct {
+	limiter *TokenBucket
+	config  AdaptiveConfig
+
+	mu           sync.Mutex
+	rate         float64   // 当前速率
+	lastDecrease time.Time // 上次减速的时间
+
+	// OnRateChange 速率变化时回调，可以用来画收敛曲线（可选）
+	OnRateChange func(rate float64)
+}
+
+// Validate 检查配置是否合法，返回所有问题（不是只返回第一个）
+func (c AdaptiveConfig) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// 写成 !(x > 0) 而不是 x <= 0，NaN 也会被拒绝
+	if !(c.MinRate > 0) {
+		add("MinRate 必须大于 0，当前为 %v", c.MinRate)
+	}
+	if !(c.MaxRate >= c.MinRate) || math.IsInf(c.MaxRate, 0) {
+		add("MaxRate (%v) 必须是不小于 MinRate (%v) 的有限值", c.MaxRate, c.MinRate)
+	}
+	if !(c.InitialRate > 0) {
+		add("InitialRate 必须大于 0，当前为 %v", c.InitialRate)
+	}
+	if !(c.Increase >= 0) || math.IsInf(c.Increase, 0) {
+		add("Increase 必须是非负的有限值，当前为 %v", c.Increase)
+	}
+	if !(c.DecreaseFactor > 0 && c.DecreaseFactor < 1) {
+		add("DecreaseFactor 必须在 (0, 1) 之间，当前为 %v", c.DecreaseFactor)
+	}
+	if c.LatencyTarget < 0 {
+		add("LatencyTarget 不能为负数，当前为 %v", c.LatencyTarget)
+	}
+	if c.Cooldown < 0 {
+		add("Cooldown 不能为负数，当前为 %v", c.Cooldown)
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewAdaptiveLimiter 创建自适应限流器，配置不合法时返回错误
+// burstSize: 突发容量，和 NewTokenBucket 的含义一样
+func NewAdaptiveLimiter(config AdaptiveConfig, burstSize int) (*AdaptiveLimiter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("自适应限流配置不合法: %w", err)
+	}
+	if burstSize < 1 {
+		return nil, fmt.Errorf("突发容量至少为 1，当前为 %d", burstSize)
+	}
+	rate := clampRate(config.InitialRate, config.MinRate, config.MaxRate)
+
+	limiter := NewTokenBucket(1, burstSize)
+	if err := limiter.SetRate(rate); err != nil {
+		return nil, err
+	}
+
+	return &AdaptiveLimiter{
+		limiter: limiter,
+		config:  config,
+		rate:    rate,
+	}, nil
+}
+
+// Allow 尝试获取一个令牌（非阻塞）
+func (al *AdaptiveLimiter) Allow() bool {
+	return al.limiter.Allow()
+}
+
+// Wait 等待获取一个令牌（阻塞）
+func (al *AdaptiveLimiter) Wait() {
+	al.limiter.Wait()
+}
+
+// WaitN 等待获取 n 个令牌，ctx 取消时返回 ctx.Err()
+func (al *AdaptiveLimiter) WaitN(ctx context.Context, n int) error {
+	return al.limiter.WaitN(ctx, n)
+}
+
+// Success 反馈一次成功的调用
+// latency 超过 LatencyTarget 时按拥塞处理，否则加性增
+func (al *AdaptiveLimiter) Success(latency time.Duration) {
+	if al.config.LatencyTarget > 0 && latency > al.config.LatencyTarget {
+		al.decrease()
+		return
+	}
+
+	al.mu.Lock()
+	// 每次成功提高 Increase/rate，当前速率下跑满一秒正好提高 Increase
+	newRate := clampRate(al.rate+al.config.Increase/al.rate, al.config.MinRate, al.config.MaxRate)
+	changed := al.setRateLocked(newRate)
+	al.mu.Unlock()
+
+	al.notify(changed, newRate)
+}
+
+// Throttled 反馈一次被下游限流的调用（比如 HTTP 429）
+func (al *AdaptiveLimiter) Throttled() {
+	al.decrease()
+}
+
+// Rate 返回当前速率（每秒请求数）
+func (al *AdaptiveLimiter) Rate() float64 {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return al.rate
+}
+
+// decrease 乘性减，冷却时间内只减一次
+func (al *AdaptiveLimiter) decrease() {
+	al.mu.Lock()
+	if time.Since(al.lastDecrease) < al.config.Cooldown {
+		al.mu.Unlock()
+		return
+	}
+	al.lastDecrease = time.Now()
+	newRate := clampRate(al.rate*al.config.DecreaseFactor, al.config.MinRate, al.config.MaxRate)
+	changed := al.setRateLocked(newRate)
+	al.mu.Unlock()
+
+	al.notify(changed, newRate)
+}
+
+// setRateLocked 更新速率，返回速率是否真的变化了（调用方需持有锁）
+func (al *AdaptiveLimiter) setRateLocked(rate float64) bool {
+	if rate == al.rate {
+		return false
+	}
+	if err := al.limiter.SetRate(rate); err != nil {
+		return false // 配置校验过，速率始终在 [MinRate, MaxRate] 之间，不会走到这里
+	}
+	al.rate = rate
+	return true
+}
+
+// notify 在锁外调用回调，避免回调里再调用 Rate() 造成死锁
+func (al *AdaptiveLimiter) notify(changed bool, rate float64) {
+	if changed && al.OnRateChange != nil {
+		al.OnRateChange(rate)
+	}
+}
+
+// clampRate 把速率限制在 [lo, hi] 之间
+func clampRate(rate, lo, hi float64) float64 {
+	if rate < lo {
+		return lo
+	}
+	if rate > hi {
+		return hi
+	}
+	return rate
+}
+
+// ============================================
+// 演示: 摸索一个未知限额的第三方 API
+// ============================================
+
+func adaptiveLimiterDemo() {
+	fmt.Println("📍 自适应限流演示: 第三方 API 实际限额 20/s，但我们不知道")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	// 用一个 TokenBucket 模拟第三方服务端的限额
+	server := NewTokenBucket(20, 1)
+
+	config := DefaultAdaptiveConfig
+	config.Increase = 5
+	config.Cooldown = 200 * time.Millisecond
+	client, err := NewAdaptiveLimiter(config, 1)
+	if err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+
+	start := time.Now()
+	nextReport := time.Duration(0)
+	for time.Since(start) < 3*time.Second {
+		client.Wait()
+		if server.Allow() {
+			client.Success(10 * time.Millisecond)
+		} else {
+			client.Throttled() // 模拟收到 429
+		}
+
+		if elapsed := time.Since(start); elapsed >= nextReport {
+			fmt.Printf("  t=%4dms  当前速率: %5.1f/s\n", elapsed.Milliseconds(), client.Rate())
+			nextReport += 250 * time.Millisecond
+		}
+	}
+
+	fmt.Println("💡 速率在 20/s 附近来回摆动：撞到限额就砍半，然后再慢慢爬升")
+}
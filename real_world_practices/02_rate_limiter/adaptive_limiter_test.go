@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewAdaptiveLimiterRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *AdaptiveConfig)
+	}{
+		{"零值配置", func(c *AdaptiveConfig) { *c = AdaptiveConfig{} }},
+		{"MinRate 为 0", func(c *AdaptiveConfig) { c.MinRate = 0 }},
+		{"MinRate 大于 MaxRate", func(c *AdaptiveConfig) { c.MinRate, c.MaxRate = 10, 5 }},
+		{"MaxRate 无穷大", func(c *AdaptiveConfig) { c.MaxRate = math.Inf(1) }},
+		{"InitialRate 为 NaN", func(c *AdaptiveConfig) { c.InitialRate = math.NaN() }},
+		{"DecreaseFactor 为 0", func(c *AdaptiveConfig) { c.DecreaseFactor = 0 }},
+		{"DecreaseFactor 为 1", func(c *AdaptiveConfig) { c.DecreaseFactor = 1 }},
+		{"DecreaseFactor 大于 1", func(c *AdaptiveConfig) { c.DecreaseFactor = 1.5 }},
+		{"Increase 为负数", func(c *AdaptiveConfig) { c.Increase = -1 }},
+		{"Cooldown 为负数", func(c *AdaptiveConfig) { c.Cooldown = -time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultAdaptiveConfig
+			tt.modify(&config)
+			if _, err := NewAdaptiveLimiter(config, 1); err == nil {
+				t.Error("应该返回错误")
+			}
+		})
+	}
+
+	if _, err := NewAdaptiveLimiter(DefaultAdaptiveConfig, 0); err == nil {
+		t.Error("突发容量为 0 应该返回错误")
+	}
+}
+
+func TestAdaptiveLimiterStaysWithinBounds(t *testing.T) {
+	config := DefaultAdaptiveConfig
+	config.MinRate, config.MaxRate = 2, 8
+	config.Cooldown = 0
+
+	al, err := NewAdaptiveLimiter(config, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		al.Throttled()
+	}
+	if got := al.Rate(); got != 2 {
+		t.Errorf("连续被限流后速率 = %v，期望停在 MinRate 2", got)
+	}
+	for i := 0; i < 1000; i++ {
+		al.Success(0)
+	}
+	if got := al.Rate(); got != 8 {
+		t.Errorf("持续成功后速率 = %v，期望停在 MaxRate 8", got)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+🔧 限流配置热更新
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+合作方提高了配额，不想重启服务？
+把速率和突发容量写在配置文件里，后台 goroutine 定期检查文件，
+发现变化就调用 SetRate / SetBurst，正在等待的请求也会立即按新配置计算。
+
+配置文件格式 (JSON):
+{
+    "requests_per_second": 10,
+    "burst_size": 20
+}
+
+🔨 实现思路:
+1. time.Ticker 定期 os.Stat 检查文件修改时间（不依赖 fsnotify 等第三方库）
+2. 修改时间变了就重新读取、校验
+3. 只有数值真正变化时才调用 SetRate / SetBurst
+*/
+
+// LimiterConfig 限流配置
+type LimiterConfig struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	BurstSize         int     `json:"burst_size"`
+}
+
+// Validate 校验配置是否合法
+func (c LimiterConfig) Validate() error {
+	if c.RequestsPerSecond <= 0 {
+		return fmt.Errorf("requests_per_second 必须大于 0，当前为 %v", c.RequestsPerSecond)
+	}
+	if c.BurstSize <= 0 {
+		return fmt.Errorf("burst_size 必须大于 0，当前为 %d", c.BurstSize)
+	}
+	return nil
+}
+
+// LoadLimiterConfig 从文件读取限流配置
+func LoadLimiterConfig(path string) (LimiterConfig, error) {
+	var config LimiterConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("读取限流配置失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("解析限流配置 %s 失败: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("限流配置 %s 不合法: %w", path, err)
+	}
+	return config, nil
+}
+
+// ConfigWatcher 监听配置文件，把变化应用到限流器上
+type ConfigWatcher struct {
+	path     string
+	limiter  *TokenBucket
+	interval time.Duration // 检查文件的间隔
+
+	OnChange func(config LimiterConfig) // 配置生效后回调（可选，需在 Start 之前设置）
+	OnError  func(err error)            // 后台读取或校验失败时回调，限流器保持旧配置（可选）
+
+	modTime time.Time     // 上次读取时文件的修改时间
+	current LimiterConfig // 当前生效的配置
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewConfigWatcher 创建配置监听器，每隔 interval 检查一次文件
+func NewConfigWatcher(path string, limiter *TokenBucket, interval time.Duration) *ConfigWatcher {
+	return &ConfigWatcher{
+		path:     path,
+		limiter:  limiter,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 立即读取一次配置并应用，然后启动后台监听
+// 第一次读取失败直接返回错误，不会启动监听
+func (cw *ConfigWatcher) Start() error {
+	if err := cw.reload(); err != nil {
+		return err
+	}
+
+	go cw.watchLoop()
+
+	return nil
+}
+
+// Stop 停止监听
+func (cw *ConfigWatcher) Stop() {
+	cw.stopOnce.Do(func() {
+		close(cw.done)
+	})
+}
+
+// watchLoop 后台定期检查配置文件
+func (cw *ConfigWatcher) watchLoop() {
+	ticker := time.NewTicker(cw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := cw.reload(); err != nil && cw.OnError != nil {
+				cw.OnError(err)
+			}
+		case <-cw.done:
+			return
+		}
+	}
+}
+
+// reload 文件有变化时重新读取并应用
+func (cw *ConfigWatcher) reload() error {
+	info, err := os.Stat(cw.path)
+	if err != nil {
+		return fmt.Errorf("读取限流配置失败: %w", err)
+	}
+	if info.ModTime().Equal(cw.modTime) {
+		return nil // 文件没变
+	}
+
+	config, err := LoadLimiterConfig(cw.path)
+	if err != nil {
+		return err
+	}
+
+	if config.RequestsPerSecond != cw.current.RequestsPerSecond {
+		if err := cw.limiter.SetRate(config.RequestsPerSecond); err != nil {
+			return fmt.Errorf("限流配置 %s 不合法: %w", cw.path, err)
+		}
+	}
+	if config.BurstSize != cw.current.BurstSize {
+		if err := cw.limiter.SetBurst(config.BurstSize); err != nil {
+			return fmt.Errorf("限流配置 %s 不合法: %w", cw.path, err)
+		}
+	}
+	cw.modTime = info.ModTime()
+	if config != cw.current {
+		cw.current = config
+		if cw.OnChange != nil {
+			cw.OnChange(config)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeLimiterConfig 写入配置文件，并把修改时间往后拨，保证监听器能看出变化
+func writeLimiterConfig(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// eventually 在一秒内反复检查 cond
+func eventually(t *testing.T, cond func() bool, format string, args ...any) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConfigWatcherAppliesAndReloadsConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limiter.json")
+	base := time.Now().Add(-time.Hour)
+	writeLimiterConfig(t, path, `{"requests_per_second": 5, "burst_size": 3}`, base)
+
+	limiter := NewTokenBucket(1, 1)
+	watcher := NewConfigWatcher(path, limiter, 10*time.Millisecond)
+
+	var mu sync.Mutex
+	var changes []LimiterConfig
+	watcher.OnChange = func(config LimiterConfig) {
+		mu.Lock()
+		changes = append(changes, config)
+		mu.Unlock()
+	}
+
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	if rate, burst := limiter.Rate(), limiter.Limit(); math.Abs(rate-5) > 1e-9 || burst != 3 {
+		t.Fatalf("Start 后速率 %v、容量 %d，期望 5 和 3", rate, burst)
+	}
+
+	writeLimiterConfig(t, path, `{"requests_per_second": 20, "burst_size": 10}`, base.Add(time.Minute))
+	eventually(t, func() bool { return limiter.Limit() == 10 }, "改文件后容量一直是 %d，期望 10", limiter.Limit())
+	if rate := limiter.Rate(); math.Abs(rate-20) > 1e-9 {
+		t.Errorf("改文件后速率 %v，期望 20", rate)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []LimiterConfig{{5, 3}, {20, 10}}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("OnChange 收到 %v，期望 %v", changes, want)
+	}
+}
+
+func TestConfigWatcherKeepsOldConfigOnBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limiter.json")
+	base := time.Now().Add(-time.Hour)
+	writeLimiterConfig(t, path, `{"requests_per_second": 5, "burst_size": 3}`, base)
+
+	limiter := NewTokenBucket(1, 1)
+	watcher := NewConfigWatcher(path, limiter, 10*time.Millisecond)
+	errs := make(chan error, 10)
+	watcher.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	for i, bad := range []string{
+		`{"requests_per_second": 0, "burst_size": 3}`,
+		`{"requests_per_second": 5, "burst_size": 0}`,
+		`{"requests_per_second": `,
+	} {
+		writeLimiterConfig(t, path, bad, base.Add(time.Duration(i+1)*time.Minute))
+		select {
+		case <-errs:
+		case <-time.After(time.Second):
+			t.Fatalf("不合法的配置 %s 没有触发 OnError", bad)
+		}
+		if rate, burst := limiter.Rate(), limiter.Limit(); math.Abs(rate-5) > 1e-9 || burst != 3 {
+			t.Errorf("配置 %s 之后速率 %v、容量 %d，期望保持 5 和 3", bad, rate, burst)
+		}
+	}
+}
+
+func TestConfigWatcherStartFailsWithoutFile(t *testing.T) {
+	watcher := NewConfigWatcher(filepath.Join(t.TempDir(), "missing.json"), NewTokenBucket(1, 1), time.Second)
+	if err := watcher.Start(); err == nil {
+		watcher.Stop()
+		t.Fatal("配置文件不存在时 Start 应该返回错误")
+	}
+}
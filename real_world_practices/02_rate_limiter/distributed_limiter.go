@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+🌍 分布式限流: 多个进程共享一份配额
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+同一台机器上跑了 4 个 worker 进程，合作方给的配额是 20/s。
+如果每个进程都 NewTokenBucket(20, ...)，实际速率就变成了 80/s！
+
+解决办法：找一个"权威方"统一发放令牌，每个进程只能从它那里领。
+- token_server.go:    仓库自带的迷你 TCP 令牌服务器
+- redis_authority.go: 用 Redis（或兼容 Redis 协议的服务）当权威方
+
+💡 为什么是"租约 (Lease)" 而不是每次请求都问一次？
+每个请求都走一次网络太慢了。所以进程一次领一批令牌（比如 5 个）放在本地慢慢用，
+用完再领。这批令牌带有过期时间：
+- 过期还没用完的令牌作废，进程不能囤积令牌，全局速率才不会被突破
+- 进程正常退出时把没用完的令牌还回去（Release）
+- 进程崩溃时来不及归还，租约到期后自动作废，不会一直占着配额
+*/
+
+// Lease 从权威方领到的一批令牌
+type Lease struct {
+	Granted    int           // 实际领到的令牌数（可能比申请的少，甚至为 0）
+	ExpiresAt  time.Time     // 过期时间，过期后没用完的令牌作废
+	RetryAfter time.Duration // Granted 为 0 时，建议多久之后再来领
+}
+
+// TokenAuthority 统一发放令牌的权威方
+type TokenAuthority interface {
+	// Lease 申请最多 n 个令牌
+	Lease(ctx context.Context, key string, n int) (Lease, error)
+	// Release 归还 n 个还没用掉、也没过期的令牌
+	Release(ctx context.Context, key string, n int) error
+}
+
+// DistributedLimiter 从权威方批量领取令牌的限流器
+type DistributedLimiter struct {
+	authority TokenAuthority
+	key       string // 配额的名字，共享同一份配额的进程用同一个 key
+	batchSize int    // 每次领多少个令牌
+
+	mu         sync.Mutex
+	local      int       // 本地还剩多少个令牌
+	expiresAt  time.Time // 本地令牌的过期时间
+	retryAfter time.Time // 权威方没令牌时，这个时间之前不再去问
+}
+
+// NewDistributedLimiter 创建分布式限流器
+// batchSize 越大网络请求越少，但进程之间分配越不均匀，一般取每秒配额的 1/10 ~ 1/4
+func NewDistributedLimiter(authority TokenAuthority, key string, batchSize int) *DistributedLimiter {
+	return &DistributedLimiter{
+		authority: authority,
+		key:       key,
+		batchSize: batchSize,
+	}
+}
+
+// Allow 尝试获取一个令牌（本地没有时会向权威方领一批）
+// 权威方不可用时返回 false（宁可拒绝，也不能突破全局配额）
+func (dl *DistributedLimiter) Allow() bool {
+	ok, _, _ := dl.tryAcquire(context.Background())
+	return ok
+}
+
+// Wait 等待获取一个令牌，ctx 取消时返回 ctx.Err()
+func (dl *DistributedLimiter) Wait(ctx context.Context) error {
+	for {
+		ok, retry, err := dl.tryAcquire(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Close 把本地还没用掉的令牌还给权威方
+func (dl *DistributedLimiter) Close(ctx context.Context) error {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	if dl.local == 0 || time.Now().After(dl.expiresAt) {
+		dl.local = 0
+		return nil
+	}
+	n := dl.local
+	dl.local = 0
+	return dl.authority.Release(ctx, dl.key, n)
+}
+
+// tryAcquire 先用本地令牌，没有了再向权威方领
+// 返回值: 是否拿到令牌、拿不到时建议等多久、权威方的错误
+func (dl *DistributedLimiter) tryAcquire(ctx context.Context) (bool, time.Duration, error) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	now := time.Now()
+	if now.After(dl.expiresAt) {
+		dl.local = 0 // 租约过期，剩下的令牌作废
+	}
+	if dl.local > 0 {
+		dl.local--
+		return true, 0, nil
+	}
+	if now.Before(dl.retryAfter) {
+		return false, dl.retryAfter.Sub(now), nil
+	}
+
+	lease, err := dl.authority.Lease(ctx, dl.key, dl.batchSize)
+	if err != nil {
+		return false, 0, fmt.Errorf("向权威方领取令牌失败: %w", err)
+	}
+	if lease.Granted == 0 {
+		retry := lease.RetryAfter
+		if retry <= 0 {
+			retry = 10 * time.Millisecond
+		}
+		dl.retryAfter = now.Add(retry)
+		return false, retry, nil
+	}
+
+	dl.local = lease.Granted - 1 // 领到的第一个令牌直接给这次调用
+	dl.expiresAt = lease.ExpiresAt
+	return true, 0, nil
+}
+
+// ============================================
+// 演示: 4 个 "进程" 共享 20/s 的配额
+// ============================================
+
+func distributedLimiterDemo() {
+	fmt.Println("📍 分布式限流演示: 4 个 worker 共享 20/s 的配额（突发 5）")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	server := NewTokenServer(20, 5, 500*time.Millisecond)
+	addr, err := server.Start("127.0.0.1:0")
+	if err != nil {
+		fmt.Println("  ❌ 启动令牌服务器失败:", err)
+		return
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	counts := make([]int, 4)
+	var wg sync.WaitGroup
+	for i := range counts {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			// 每个 worker 有自己的连接，就像独立的进程一样
+			client := NewTokenClient(addr)
+			defer client.Close()
+			limiter := NewDistributedLimiter(client, "partner-api", 2)
+			defer limiter.Close(context.Background())
+
+			for limiter.Wait(ctx) == nil {
+				counts[worker]++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i, count := range counts {
+		fmt.Printf("  Worker %d: %d 个请求\n", i+1, count)
+		total += count
+	}
+	fmt.Printf("  合计: %d 个请求 / 2 秒 (上限 = 5 突发 + 20/s × 2s = 45)\n", total)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTokenServer 启动一个本地令牌服务器，测试结束时关闭
+func startTokenServer(t *testing.T, requestsPerSecond, burstSize int, leaseTTL time.Duration) string {
+	t.Helper()
+	server := NewTokenServer(requestsPerSecond, burstSize, leaseTTL)
+	addr, err := server.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return addr
+}
+
+// rawTokenConn 直接说文本协议的连接，用来检查服务器的每一条响应
+type rawTokenConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialTokenServer(t *testing.T, addr string) *rawTokenConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &rawTokenConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send 发送一条命令，返回响应的前两个字段，比如 "OK 3"
+func (c *rawTokenConn) send(command string) string {
+	c.t.Helper()
+	c.conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := c.conn.Write([]byte(command + "\n")); err != nil {
+		c.t.Fatal(err)
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 2 && fields[0] == "OK" {
+		fields = fields[:2] // 租约时长和重试时间跟时间有关，不比较
+	}
+	return strings.Join(fields, " ")
+}
+
+func TestTokenServerLeaseAndRelease(t *testing.T) {
+	addr := startTokenServer(t, 1, 5, time.Minute)
+	conn := dialTokenServer(t, addr)
+
+	steps := []struct{ command, want string }{
+		{"LEASE k 2", "OK 2"},
+		{"RELEASE k 5", "OK 2"}, // 只持有 2 个，多还的不算
+		{"RELEASE k 1", "OK 0"},
+		{"LEASE k 10", "OK 5"}, // 还回来的 2 个又能领了，最多领到容量
+		{"LEASE k 1", "OK 0"},
+		{"LEASE other 1", "OK 1"}, // 不同 key 的配额互不影响
+	}
+	for _, step := range steps {
+		if got := conn.send(step.command); got != step.want {
+			t.Errorf("%s → %q，期望 %q", step.command, got, step.want)
+		}
+	}
+
+	for _, bad := range []string{"LEASE k", "LEASE k 0", "LEASE k -1", "LEASE k x", "STEAL k 1"} {
+		if got := conn.send(bad); !strings.HasPrefix(got, "ERR") {
+			t.Errorf("%s → %q，期望 ERR", bad, got)
+		}
+	}
+}
+
+func TestTokenServerRejectsExpiredLeaseRelease(t *testing.T) {
+	addr := startTokenServer(t, 1, 5, 50*time.Millisecond)
+	conn := dialTokenServer(t, addr)
+
+	if got := conn.send("LEASE k 3"); got != "OK 3" {
+		t.Fatalf("LEASE k 3 → %q", got)
+	}
+	time.Sleep(80 * time.Millisecond)
+
+	if got := conn.send("RELEASE k 3"); got != "OK 0" {
+		t.Errorf("租约过期后 RELEASE k 3 → %q，期望 OK 0", got)
+	}
+}
+
+func TestTokenServerDropsLeasesOfDisconnectedClients(t *testing.T) {
+	addr := startTokenServer(t, 1, 5, time.Minute)
+
+	crashed := dialTokenServer(t, addr)
+	if got := crashed.send("LEASE k 5"); got != "OK 5" {
+		t.Fatalf("LEASE k 5 → %q", got)
+	}
+	crashed.conn.Close() // 进程崩溃，来不及归还
+
+	// 别的连接不能替它还：那些令牌不是这条连接领的
+	other := dialTokenServer(t, addr)
+	if got := other.send("RELEASE k 5"); got != "OK 0" {
+		t.Errorf("替断开的连接归还 → %q，期望 OK 0", got)
+	}
+	if got := other.send("LEASE k 5"); got != "OK 0" {
+		t.Errorf("断开连接的令牌被还回来了: LEASE k 5 → %q，期望 OK 0", got)
+	}
+}
+
+func TestDistributedLimiterHoldsGlobalRate(t *testing.T) {
+	const (
+		rate     = 20
+		burst    = 5
+		duration = time.Second
+	)
+	addr := startTokenServer(t, rate, burst, 500*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var mu sync.Mutex
+	total := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := NewTokenClient(addr)
+			defer client.Close()
+			limiter := NewDistributedLimiter(client, "partner-api", 2)
+			defer limiter.Close(context.Background())
+
+			for limiter.Wait(ctx) == nil {
+				mu.Lock()
+				total++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 4 个客户端加起来也不能超过 突发 + 速率 × 时间；每个客户端各自 20/s 的话会有 80 多个
+	limit := burst + int(rate*duration.Seconds())
+	if total > limit+1 || total < limit/2 {
+		t.Errorf("4 个客户端 %v 内一共放行 %d 个，期望接近且不超过 %d", duration, total, limit)
+	}
+}
+
+func TestDistributedLimiterCloseReturnsUnusedTokens(t *testing.T) {
+	addr := startTokenServer(t, 1, 5, time.Minute)
+
+	client := NewTokenClient(addr)
+	defer client.Close()
+	limiter := NewDistributedLimiter(client, "k", 5)
+	if !limiter.Allow() {
+		t.Fatal("第一次 Allow 应该领到令牌")
+	}
+	if err := limiter.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 领了 5 个、用了 1 个、还了 4 个
+	conn := dialTokenServer(t, addr)
+	if got := conn.send("LEASE k 5"); got != "OK 4" {
+		t.Errorf("Close 之后 LEASE k 5 → %q，期望 OK 4", got)
+	}
+}
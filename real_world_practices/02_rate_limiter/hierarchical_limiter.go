@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+/*
+🏢 分层限流 (全局 → 租户 → 用户)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+合同里的限额是一层套一层的：
+- 整个应用: 1000/s
+- 每个租户: 100/s
+- 每个用户:   5/s
+
+一个请求必须三层都有令牌才能放行。
+
+⚠️ 容易踩的坑:
+依次调用三个 Allow()，全局和租户都拿到了令牌，用户这层被拒绝——
+前两层的令牌就白白扣掉了，一个被拒绝的用户会把整个租户的配额拖下去。
+
+先扣再退（refund）也不行：扣掉到退回之间，别的请求会看到一个"被借走"的全局令牌，
+明明有余量也会被拒绝；统计里还会多出几次根本没发生的放行。
+
+🔨 实现思路:
+1. 按固定顺序（全局 → 租户 → 用户）锁住各层的限流器，顺序固定就不会死锁
+2. 持有所有锁时逐层检查令牌，全部够了才统一扣掉，有一层不够就一个都不扣
+3. 告诉调用方是哪一层拒绝的，方便返回不同的错误提示
+*/
+
+// 各层的名字
+const (
+	LevelGlobal = "global"
+	LevelTenant = "tenant"
+	LevelUser   = "user"
+)
+
+// LimitDecision 一次限流判断的结果
+type LimitDecision struct {
+	Allowed    bool
+	RejectedBy string        // 被哪一层拒绝（Allowed 为 true 时为空）
+	RetryAfter time.Duration // 被拒绝时，这一层多久后会有令牌
+}
+
+// HierarchicalLimiter 分层限流器
+type HierarchicalLimiter struct {
+	global  *TokenBucket
+	tenants *KeyedLimiter
+	users   *KeyedLimiter
+}
+
+// NewHierarchicalLimiter 创建分层限流器
+// 任何一层传 nil 表示这一层不限流
+func NewHierarchicalLimiter(global *TokenBucket, tenants *KeyedLimiter, users *KeyedLimiter) *HierarchicalLimiter {
+	return &HierarchicalLimiter{
+		global:  global,
+		tenants: tenants,
+		users:   users,
+	}
+}
+
+// Allow 判断 tenant 下的 user 能否发一个请求（非阻塞）
+// 要么三层都扣掉一个令牌，要么一个都不扣
+func (hl *HierarchicalLimiter) Allow(tenant string, user string) LimitDecision {
+	levels := hl.levels(tenant, user)
+
+	// levels 已经是从上到下的固定顺序，所有调用方都按这个顺序加锁
+	for _, level := range levels {
+		level.limiter.mu.Lock()
+	}
+
+	now := time.Now()
+	decision := LimitDecision{Allowed: true}
+	events := make([]LimiterEvent, len(levels))
+	for i, level := range levels {
+		events[i] = LimiterEvent{
+			Time:     now,
+			Op:       "allow",
+			N:        1,
+			Tokens:   level.limiter.tokensLocked(now),
+			Capacity: level.limiter.state.Capacity,
+		}
+		if events[i].Tokens < 1 {
+			decision = LimitDecision{RejectedBy: level.name, RetryAfter: level.limiter.state.Delay(1)}
+			events = events[:i+1]
+			break
+		}
+	}
+	if decision.Allowed {
+		for i, level := range levels {
+			level.limiter.takeLocked(1)
+			events[i].Allowed = true
+		}
+	}
+
+	for i := len(levels) - 1; i >= 0; i-- {
+		levels[i].limiter.mu.Unlock()
+	}
+
+	// 放行时每一层都记一次放行；拒绝时只有拒绝的那一层记一次拒绝，上面几层什么都没发生
+	for i, event := range events {
+		if event.Allowed || i == len(events)-1 {
+			levels[i].limiter.observe(event)
+		}
+	}
+	return decision
+}
+
+// Wait 等待直到三层都有令牌，ctx 取消时返回 ctx.Err()
+func (hl *HierarchicalLimiter) Wait(ctx context.Context, tenant string, user string) error {
+	for {
+		decision := hl.Allow(tenant, user)
+		if decision.Allowed {
+			return nil
+		}
+
+		retry := decision.RetryAfter
+		if retry <= 0 {
+			retry = time.Millisecond // 令牌刚好被别人抢走，稍后再试
+		}
+		timer := time.NewTimer(retry)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// namedLimiter 带名字的一层
+type namedLimiter struct {
+	name    string
+	limiter *TokenBucket
+}
+
+// levels 按从上到下的顺序列出这次请求涉及的各层
+func (hl *HierarchicalLimiter) levels(tenant string, user string) []namedLimiter {
+	levels := make([]namedLimiter, 0, 3)
+	if hl.global != nil {
+		levels = append(levels, namedLimiter{LevelGlobal, hl.global})
+	}
+	if hl.tenants != nil {
+		levels = append(levels, namedLimiter{LevelTenant, hl.tenants.Get(tenant)})
+	}
+	if hl.users != nil {
+		// 不同租户下可能有同名用户，key 里带上租户
+		levels = append(levels, namedLimiter{LevelUser, hl.users.Get(tenant + "/" + user)})
+	}
+	return levels
+}
+
+// ============================================
+// 演示: 用户超限不会拖累租户
+// ============================================
+
+func hierarchicalLimiterDemo() {
+	fmt.Println("📍 分层限流演示: 全局 20/s，每个租户 10/s，每个用户 3/s（突发同速率）")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	tenants := NewKeyedLimiter(10, 10)
+	defer tenants.Stop()
+	users := NewKeyedLimiter(3, 3)
+	defer users.Stop()
+
+	hl := NewHierarchicalLimiter(NewTokenBucket(20, 20), tenants, users)
+
+	// alice 疯狂请求，只有 3 个能通过
+	for i := 1; i <= 6; i++ {
+		decision := hl.Allow("acme", "alice")
+		if decision.Allowed {
+			fmt.Printf("  ✅ acme/alice 请求 %d 通过\n", i)
+		} else {
+			fmt.Printf("  ❌ acme/alice 请求 %d 被 %s 层拒绝（%v 后重试）\n",
+				i, decision.RejectedBy, decision.RetryAfter.Round(time.Millisecond))
+		}
+	}
+
+	// alice 被拒绝的请求没有消耗租户配额
+	fmt.Printf("  acme 租户剩余令牌: %d（只扣了 alice 通过的 3 个）\n", tenants.Get("acme").Remaining())
+
+	// 同一个租户的其他用户把租户配额用完
+	for _, user := range []string{"bob", "carol", "dave"} {
+		for i := 0; i < 3; i++ {
+			if decision := hl.Allow("acme", user); !decision.Allowed {
+				fmt.Printf("  ❌ acme/%s 被 %s 层拒绝\n", user, decision.RejectedBy)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHierarchicalLimiterRejectionTakesNothing(t *testing.T) {
+	tenants := NewKeyedLimiter(1, 10)
+	defer tenants.Stop()
+	users := NewKeyedLimiter(1, 1)
+	defer users.Stop()
+	global := NewTokenBucket(1, 10)
+	hl := NewHierarchicalLimiter(global, tenants, users)
+
+	if decision := hl.Allow("acme", "alice"); !decision.Allowed {
+		t.Fatalf("第一个请求被 %s 层拒绝", decision.RejectedBy)
+	}
+	for i := 0; i < 5; i++ {
+		decision := hl.Allow("acme", "alice")
+		if decision.Allowed || decision.RejectedBy != LevelUser {
+			t.Fatalf("decision = %+v，期望被 user 层拒绝", decision)
+		}
+		if decision.RetryAfter <= 0 {
+			t.Errorf("RetryAfter = %v，期望大于 0", decision.RetryAfter)
+		}
+	}
+
+	if got := global.Remaining(); got != 9 {
+		t.Errorf("全局剩余令牌 = %d，期望 9（被拒绝的请求不扣令牌）", got)
+	}
+	if got := tenants.Get("acme").Remaining(); got != 9 {
+		t.Errorf("租户剩余令牌 = %d，期望 9", got)
+	}
+}
+
+func TestHierarchicalLimiterRejectionsDoNotBlockOthers(t *testing.T) {
+	users := NewKeyedLimiter(1, 1)
+	defer users.Stop()
+	global := NewTokenBucket(1, 2)
+	globalMetrics := NewLimiterMetrics()
+	global.SetMetrics(globalMetrics)
+	hl := NewHierarchicalLimiter(global, nil, users)
+
+	if !hl.Allow("acme", "spammer").Allowed {
+		t.Fatal("spammer 的第一个请求应该通过")
+	}
+	// 测试期间不能补充令牌，否则 spammer 会重新拿到令牌
+	global.SetRate(0.001)
+	spammer := users.Get("acme/spammer")
+	spammer.SetRate(0.001)
+	userMetrics := NewLimiterMetrics()
+	spammer.SetMetrics(userMetrics)
+
+	// spammer 的请求全都被 user 层拒绝，同时 bob 来拿全局剩下的最后一个令牌
+	stop := make(chan struct{})
+	var storm int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if hl.Allow("acme", "spammer").Allowed {
+					t.Error("spammer 不应该再通过")
+				}
+				atomic.AddInt64(&storm, 1)
+			}
+		}()
+	}
+	for atomic.LoadInt64(&storm) < 1000 {
+	}
+	decision := hl.Allow("acme", "bob")
+	close(stop)
+	wg.Wait()
+
+	if !decision.Allowed {
+		t.Errorf("bob 被 %s 层拒绝：spammer 被拒绝的请求占用了全局令牌", decision.RejectedBy)
+	}
+	if got := atomic.LoadInt64(&globalMetrics.Allowed); got != 2 {
+		t.Errorf("全局层记录了 %d 次放行，期望 2（被拒绝的请求不应该记成全局放行）", got)
+	}
+	// bob 拿走最后一个全局令牌之后，spammer 的请求会先被全局层拒绝；每个被拒绝的请求只记一次拒绝
+	rejected := atomic.LoadInt64(&globalMetrics.Rejected) + atomic.LoadInt64(&userMetrics.Rejected)
+	if want := atomic.LoadInt64(&storm); rejected != want {
+		t.Errorf("各层一共记录了 %d 次拒绝，期望 %d", rejected, want)
+	}
+}
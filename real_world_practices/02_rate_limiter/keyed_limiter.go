@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+🔑 按 key 限流 (Keyed Limiter)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+一个 TokenBucket 只能限制"整体"的速度。
+真实项目里通常要"每个用户 / 每个 IP / 每个接口"各自限流，
+所以需要按 key 维护一组 TokenBucket。
+
+🔨 实现思路:
+1. map[key]*TokenBucket 存放每个 key 的限流器，用 Mutex 保护
+2. 第一次见到某个 key 时再创建（懒加载）
+3. 后台 goroutine 定期清理长时间不活跃的 key，避免 map 无限增长
+*/
+
+// keyedEntry 一个 key 对应的限流器
+type keyedEntry struct {
+	limiter  *TokenBucket
+	lastSeen time.Time // 最近一次被使用的时间
+}
+
+// KeyedLimiter 按 key 分别限流
+type KeyedLimiter struct {
+	requestsPerSecond int
+	burstSize         int
+	idleTimeout       time.Duration // 超过这个时间没被使用的 key 会被清理
+
+	mu       sync.Mutex
+	limiters map[string]*keyedEntry
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewKeyedLimiter 创建按 key 限流的限流器
+// 每个 key 都拥有独立的令牌桶：每秒 requestsPerSecond 个请求，突发容量 burstSize
+func NewKeyedLimiter(requestsPerSecond int, burstSize int) *KeyedLimiter {
+	kl := &KeyedLimiter{
+		requestsPerSecond: requestsPerSecond,
+		burstSize:         burstSize,
+		idleTimeout:       10 * time.Minute,
+		limiters:          make(map[string]*keyedEntry),
+		done:              make(chan struct{}),
+	}
+
+	// 启动后台清理 goroutine
+	go kl.cleanupLoop()
+
+	return kl
+}
+
+// Get 返回 key 对应的限流器，不存在就创建
+func (kl *KeyedLimiter) Get(key string) *TokenBucket {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	entry, exists := kl.limiters[key]
+	if !exists {
+		entry = &keyedEntry{
+			limiter: NewTokenBucket(kl.requestsPerSecond, kl.burstSize),
+		}
+		kl.limiters[key] = entry
+	}
+	entry.lastSeen = time.Now()
+
+	return entry.limiter
+}
+
+// Allow 对 key 尝试获取一个令牌（非阻塞）
+func (kl *KeyedLimiter) Allow(key string) bool {
+	return kl.Get(key).Allow()
+}
+
+// Wait 对 key 等待获取一个令牌（阻塞）
+func (kl *KeyedLimiter) Wait(key string) {
+	kl.Get(key).Wait()
+}
+
+// Count 返回当前维护的 key 数量
+func (kl *KeyedLimiter) Count() int {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	return len(kl.limiters)
+}
+
+// Stop 停止所有 key 的限流器
+func (kl *KeyedLimiter) Stop() {
+	kl.stopOnce.Do(func() {
+		close(kl.done)
+
+		kl.mu.Lock()
+		defer kl.mu.Unlock()
+		for key, entry := range kl.limiters {
+			entry.limiter.Stop()
+			delete(kl.limiters, key)
+		}
+	})
+}
+
+// cleanupLoop 后台清理不活跃的 key
+func (kl *KeyedLimiter) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute) // 每分钟检查一次
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			kl.cleanup()
+		case <-kl.done:
+			return
+		}
+	}
+}
+
+// cleanup 清理超过 idleTimeout 没被使用的 key
+func (kl *KeyedLimiter) cleanup() {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	for key, entry := range kl.limiters {
+		if time.Since(entry.lastSeen) > kl.idleTimeout {
+			entry.limiter.Stop()
+			delete(kl.limiters, key)
+		}
+	}
+}
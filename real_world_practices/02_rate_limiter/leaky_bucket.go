@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+🪣 漏桶限流器 (Leaky Bucket)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+令牌桶 vs 漏桶:
+- 令牌桶: 桶里攒了多少令牌，就允许多少突发请求同时通过，之后再慢慢放行
+- 漏桶:   请求先进队列排队，桶底按固定间隔"漏"出一个，绝不突发
+
+适用场景:
+短信网关、推送通道等要求"严格均匀间隔"的下游，突发一下就可能被运营商拦截。
+
+🔨 实现思路:
+1. 调用方进入 FIFO 队列（队列有最大长度，满了直接拒绝）
+2. 后台 goroutine 按顺序取出请求，保证相邻两次放行至少间隔 interval
+3. 调用方可以通过 context 取消排队，被取消的请求不占用放行名额
+*/
+
+// ErrQueueFull 漏桶排队已满
+// 调用方可以用 errors.Is(err, ErrQueueFull) 判断是否因为排队过长被拒绝
+var ErrQueueFull = errors.New("漏桶排队已满")
+
+// ErrLeakyBucketStopped 漏桶已停止
+var ErrLeakyBucketStopped = errors.New("漏桶已停止")
+
+// 排队请求的状态
+const (
+	leakyWaiting   int32 = iota // 排队中
+	leakyReleased               // 已放行
+	leakyCancelled              // 调用方已放弃
+)
+
+// leakyRequest 一个排队中的请求
+type leakyRequest struct {
+	state int32         // 状态，用 atomic 修改，避免放行和取消同时发生
+	ready chan struct{} // 放行时关闭
+}
+
+// LeakyBucket 漏桶限流器
+type LeakyBucket struct {
+	interval time.Duration // 相邻两次放行的最小间隔
+	maxQueue int           // 最大排队长度
+
+	mu      sync.Mutex
+	queue   []*leakyRequest // FIFO 队列
+	pending int             // 仍在等待放行的请求数（不含已取消的）
+
+	notify   chan struct{} // 有新请求入队时通知后台 goroutine
+	done     chan struct{} // Stop 时关闭
+	stopOnce sync.Once
+}
+
+// NewLeakyBucket 创建漏桶，参数不合法时返回错误
+// ratePerSecond: 每秒放行多少个请求（严格均匀）
+// maxQueue: 最多允许多少个请求排队
+func NewLeakyBucket(ratePerSecond int, maxQueue int) (*LeakyBucket, error) {
+	if ratePerSecond < 1 {
+		return nil, fmt.Errorf("漏桶速率至少为每秒 1 个，当前为 %d", ratePerSecond)
+	}
+	if maxQueue < 1 {
+		return nil, fmt.Errorf("漏桶最大排队长度至少为 1，当前为 %d", maxQueue)
+	}
+
+	lb := &LeakyBucket{
+		interval: time.Second / time.Duration(ratePerSecond),
+		maxQueue: maxQueue,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	go lb.leakLoop()
+
+	return lb, nil
+}
+
+// Wait 排队等待放行（阻塞）
+// 返回值是本次调用实际排队等待的时间
+// 队列满时立即返回 ErrQueueFull，ctx 取消时返回 ctx.Err()
+func (lb *LeakyBucket) Wait(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	req := &leakyRequest{ready: make(chan struct{})}
+
+	lb.mu.Lock()
+	if lb.pending >= lb.maxQueue {
+		lb.mu.Unlock()
+		return 0, fmt.Errorf("%w (最大排队 %d)", ErrQueueFull, lb.maxQueue)
+	}
+	lb.queue = append(lb.queue, req)
+	lb.pending++
+	lb.mu.Unlock()
+
+	// 非阻塞通知：后台 goroutine 只需要知道"有活干了"
+	select {
+	case lb.notify <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-req.ready:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		if lb.cancel(req) {
+			return time.Since(start), ctx.Err()
+		}
+		// 取消和放行同时发生：放行已经生效，按成功处理
+		return time.Since(start), nil
+	case <-lb.done:
+		if lb.cancel(req) {
+			return time.Since(start), ErrLeakyBucketStopped
+		}
+		return time.Since(start), nil
+	}
+}
+
+// QueueLen 返回当前排队等待的请求数
+func (lb *LeakyBucket) QueueLen() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.pending
+}
+
+// Stop 停止漏桶，所有仍在排队的调用方会收到 ErrLeakyBucketStopped
+func (lb *LeakyBucket) Stop() {
+	lb.stopOnce.Do(func() {
+		close(lb.done)
+	})
+}
+
+// cancel 调用方放弃排队，返回 false 表示请求已经被放行
+func (lb *LeakyBucket) cancel(req *leakyRequest) bool {
+	if !atomic.CompareAndSwapInt32(&req.state, leakyWaiting, leakyCancelled) {
+		return false
+	}
+	lb.mu.Lock()
+	lb.pending--
+	lb.mu.Unlock()
+	return true
+}
+
+// pop 取出队首请求，队列为空时返回 nil
+func (lb *LeakyBucket) pop() *leakyRequest {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if len(lb.queue) == 0 {
+		return nil
+	}
+	req := lb.queue[0]
+	lb.queue[0] = nil // 避免底层数组持有已出队的请求
+	lb.queue = lb.queue[1:]
+	return req
+}
+
+// leakLoop 后台按固定间隔放行请求
+func (lb *LeakyBucket) leakLoop() {
+	var lastRelease time.Time
+
+	for {
+		req := lb.pop()
+		if req == nil {
+			// 队列空了，等待新请求
+			select {
+			case <-lb.notify:
+				continue
+			case <-lb.done:
+				return
+			}
+		}
+
+		// 已经取消的请求直接跳过，不占用放行名额
+		if atomic.LoadInt32(&req.state) != leakyWaiting {
+			continue
+		}
+
+		// 距离上次放行不足 interval，就等到间隔满足为止
+		if wait := time.Until(lastRelease.Add(lb.interval)); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-lb.done:
+				timer.Stop()
+				return
+			}
+		}
+
+		// 等待期间调用方可能已经放弃，这时不更新 lastRelease，下一个请求可以立即放行
+		if !atomic.CompareAndSwapInt32(&req.state, leakyWaiting, leakyReleased) {
+			continue
+		}
+		lb.mu.Lock()
+		lb.pending--
+		lb.mu.Unlock()
+
+		lastRelease = time.Now()
+		close(req.ready)
+	}
+}
+
+// ============================================
+// 演示: 短信发送（严格均匀间隔）
+// ============================================
+
+func leakyBucketDemo() {
+	fmt.Println("📍 漏桶演示: 每秒最多发 5 条短信，最多排队 6 条")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	bucket, err := NewLeakyBucket(5, 6)
+	if err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+	defer bucket.Stop()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			waited, err := bucket.Wait(context.Background())
+			if errors.Is(err, ErrQueueFull) {
+				fmt.Printf("  ❌ [短信 %d] 排队已满，拒绝发送\n", id)
+				return
+			}
+			fmt.Printf("  📨 [短信 %d] 发送 (时间: %s, 排队: %v)\n",
+				id, time.Now().Format("15:04:05.000"), waited.Round(time.Millisecond))
+		}(i)
+		time.Sleep(time.Millisecond) // 保证入队顺序，方便观察 FIFO
+	}
+	wg.Wait()
+
+	fmt.Println("💡 相邻两条短信之间始终间隔 200ms，没有突发")
+}
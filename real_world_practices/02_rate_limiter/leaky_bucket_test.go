@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueueLen 等到漏桶里有 n 个请求在排队
+func waitQueueLen(t *testing.T, lb *LeakyBucket, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for lb.QueueLen() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("排队数 = %d，期望 %d", lb.QueueLen(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewLeakyBucketRejectsInvalidArguments(t *testing.T) {
+	for _, tt := range []struct{ rate, maxQueue int }{{0, 1}, {-1, 1}, {5, 0}, {5, -1}} {
+		if lb, err := NewLeakyBucket(tt.rate, tt.maxQueue); err == nil {
+			lb.Stop()
+			t.Errorf("NewLeakyBucket(%d, %d) 应该返回错误", tt.rate, tt.maxQueue)
+		}
+	}
+}
+
+func TestLeakyBucketRejectsWhenQueueFull(t *testing.T) {
+	lb, err := NewLeakyBucket(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一个立即放行，之后一秒内的请求都要排队
+	if _, err := lb.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	queued := make(chan error, 1)
+	go func() {
+		_, err := lb.Wait(context.Background())
+		queued <- err
+	}()
+	waitQueueLen(t, lb, 1)
+
+	start := time.Now()
+	if _, err := lb.Wait(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("队列满时 Wait 返回 %v，期望 ErrQueueFull", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("队列满时等了 %v 才拒绝，应该立即返回", elapsed)
+	}
+
+	lb.Stop()
+	if err := <-queued; !errors.Is(err, ErrLeakyBucketStopped) {
+		t.Errorf("Stop 之后排队的请求返回 %v，期望 ErrLeakyBucketStopped", err)
+	}
+}
+
+func TestLeakyBucketReleasesInOrderAtEvenIntervals(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	lb, err := NewLeakyBucket(int(time.Second/interval), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lb.Stop()
+
+	// 先放行一个，后面的请求都要按间隔排队
+	if _, err := lb.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	type release struct {
+		id     int
+		at     time.Time
+		waited time.Duration
+	}
+	var (
+		mu       sync.Mutex
+		releases []release
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			waited, err := lb.Wait(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			releases = append(releases, release{id: id, at: time.Now(), waited: waited})
+			mu.Unlock()
+		}(i)
+		waitQueueLen(t, lb, i+1) // 上一个入队了再发下一个，保证入队顺序
+	}
+	wg.Wait()
+
+	for i, r := range releases {
+		if r.id != i {
+			t.Fatalf("放行顺序 %v 不是先进先出", releases)
+		}
+		// 第 i 个至少排了 i+1 个间隔（减去入队前已经过去的一点时间）
+		if least := time.Duration(i+1)*interval - 20*time.Millisecond; r.waited < least {
+			t.Errorf("第 %d 个返回的排队时间 %v，期望至少 %v", i, r.waited, least)
+		}
+		if i > 0 {
+			if gap := r.at.Sub(releases[i-1].at); gap < interval-10*time.Millisecond {
+				t.Errorf("第 %d 个和前一个只间隔 %v，期望至少 %v", i, gap, interval)
+			}
+		}
+	}
+}
+
+func TestLeakyBucketCancelledWaiterFreesItsSlot(t *testing.T) {
+	lb, err := NewLeakyBucket(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lb.Stop()
+
+	if _, err := lb.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	waited, err := lb.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ctx 超时后 Wait 返回 %v，期望 context.DeadlineExceeded", err)
+	}
+	if waited < 20*time.Millisecond {
+		t.Errorf("返回的排队时间 %v，比 ctx 的超时还短", waited)
+	}
+	if n := lb.QueueLen(); n != 0 {
+		t.Errorf("取消之后排队数 = %d，期望 0", n)
+	}
+}
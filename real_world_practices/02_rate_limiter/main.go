@@ -199,6 +199,22 @@ func mainTest() {
 	// TODO(human): 打印统计
 	// fmt.Printf("\n通过: %d, 拒绝: %d\n", accepted, rejected)
 
+	// 进阶: 其它文件里的限流器，按从简单到复杂的顺序演示
+	for _, demo := range []func(){
+		leakyBucketDemo,         // leaky_bucket.go
+		adaptiveLimiterDemo,     // adaptive_limiter.go
+		combinedLimiterDemo,     // semaphore.go
+		persistenceDemo,         // persistence.go
+		distributedLimiterDemo,  // distributed_limiter.go
+		priorityLimiterDemo,     // priority_limiter.go
+		hierarchicalLimiterDemo, // hierarchical_limiter.go
+		metricsDemo,             // metrics.go
+		quotaLimiterDemo,        // quota_limiter.go
+	} {
+		fmt.Println()
+		demo()
+	}
+
 	fmt.Println()
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Println("💡 总结:")
@@ -209,6 +225,6 @@ func mainTest() {
 	// 💡 思考题:
 	// 1. 为什么需要 "突发容量" (burst size)？
 	// 2. Wait() 和 Allow() 分别适合什么场景？
-	// 3. 在真实项目中，限流器通常放在哪里？（提示：中间件、网关）
-	// 4. 这个实现有什么缺点？（提示：重启后令牌会重置）
+	// 3. 在真实项目中，限流器通常放在哪里？（提示：中间件、网关，见 middleware.go）
+	// 4. 这个实现有什么缺点？（提示：重启后令牌会重置，见 persistence.go）
 }
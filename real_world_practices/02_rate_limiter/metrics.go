@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+📊 限流器指标与追踪
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+接口延迟突然变高了，是下游变慢了，还是我们自己的限流器在排队？
+只看 Allow() 返回的 bool 是回答不了这个问题的。
+
+LimiterMetrics 记录:
+- 计数器: 放行 / 拒绝 / 等待后放行 / 等待中放弃 各多少次
+- 直方图: 每次 Wait 等了多久、每次判断时桶里还剩多少比例的令牌
+
+追踪回调 (Trace) 则会收到每一次判断的详细信息，可以接日志或链路追踪。
+
+💡 指标在限流器的锁外记录，计数器用 atomic 更新，对限流器本身的性能影响很小。
+*/
+
+// LimiterEvent 一次限流判断的详细信息
+type LimiterEvent struct {
+	Time     time.Time
+	Op       string        // "allow" 或 "wait"
+	N        int           // 申请的令牌数
+	Allowed  bool          // 是否拿到了令牌（wait 被取消时为 false）
+	Waited   time.Duration // Wait 实际等待的时间（allow 为 0）
+	Tokens   float64       // 判断前桶里的令牌数
+	Capacity int           // 桶的容量
+	Err      error         // wait 失败的原因: ctx 的错误，或者申请的令牌超过了桶的容量
+}
+
+// LimiterMetrics 限流器的统计指标，可以被多个限流器共享
+type LimiterMetrics struct {
+	Allowed   int64 // Allow 成功或 Wait 无需等待就拿到令牌
+	Rejected  int64 // Allow 失败，或 Wait 申请的令牌超过桶容量（永远等不到）
+	Waited    int64 // Wait 等待后拿到令牌
+	Cancelled int64 // Wait 等待中被取消
+
+	WaitTime  *Histogram // Wait 的等待时间（秒）
+	FillLevel *Histogram // 判断前桶的填充比例（0~1）
+}
+
+// NewLimiterMetrics 创建指标
+func NewLimiterMetrics() *LimiterMetrics {
+	return &LimiterMetrics{
+		WaitTime:  NewHistogram(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5),
+		FillLevel: NewHistogram(0, 0.1, 0.25, 0.5, 0.75, 1),
+	}
+}
+
+// Record 把一次判断计入指标
+func (m *LimiterMetrics) Record(event LimiterEvent) {
+	switch {
+	case event.Op == "allow" && event.Allowed:
+		atomic.AddInt64(&m.Allowed, 1)
+	case event.Op == "allow":
+		atomic.AddInt64(&m.Rejected, 1)
+	case !event.Allowed && isContextError(event.Err):
+		atomic.AddInt64(&m.Cancelled, 1)
+	case !event.Allowed:
+		atomic.AddInt64(&m.Rejected, 1)
+		return // 没有排队，不计入等待时间
+	case event.Waited > 0:
+		atomic.AddInt64(&m.Waited, 1)
+	default:
+		atomic.AddInt64(&m.Allowed, 1)
+	}
+
+	if event.Op == "wait" {
+		m.WaitTime.Observe(event.Waited.Seconds())
+	}
+	if event.Capacity > 0 {
+		m.FillLevel.Observe(event.Tokens / float64(event.Capacity))
+	}
+}
+
+// isContextError 判断 err 是否来自 ctx 取消或超时
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出指标，name 是指标名前缀
+func (m *LimiterMetrics) WritePrometheus(w io.Writer, name string) {
+	fmt.Fprintf(w, "# TYPE %s_decisions_total counter\n", name)
+	fmt.Fprintf(w, "%s_decisions_total{result=\"allowed\"} %d\n", name, atomic.LoadInt64(&m.Allowed))
+	fmt.Fprintf(w, "%s_decisions_total{result=\"rejected\"} %d\n", name, atomic.LoadInt64(&m.Rejected))
+	fmt.Fprintf(w, "%s_decisions_total{result=\"waited\"} %d\n", name, atomic.LoadInt64(&m.Waited))
+	fmt.Fprintf(w, "%s_decisions_total{result=\"cancelled\"} %d\n", name, atomic.LoadInt64(&m.Cancelled))
+	m.WaitTime.writePrometheus(w, name+"_wait_seconds")
+	m.FillLevel.writePrometheus(w, name+"_fill_ratio")
+}
+
+// ============================================
+// 直方图
+// ============================================
+
+// Histogram 固定桶边界的直方图
+type Histogram struct {
+	bounds []float64 // 每个桶的上界（包含），升序
+	counts []int64   // counts[i] 是落在 (bounds[i-1], bounds[i]] 的次数，最后一个是 +Inf 桶
+
+	mu    sync.Mutex // 只保护 sum（float 没有 atomic 加法）
+	sum   float64
+	total int64
+}
+
+// NewHistogram 创建直方图，bounds 是各个桶的上界（升序）
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// Observe 记录一个值
+func (h *Histogram) Observe(value float64) {
+	i := 0
+	for i < len(h.bounds) && value > h.bounds[i] {
+		i++
+	}
+	atomic.AddInt64(&h.counts[i], 1)
+
+	h.mu.Lock()
+	h.sum += value
+	h.total++
+	h.mu.Unlock()
+}
+
+// Count 返回记录的总次数
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+// Mean 返回平均值
+func (h *Histogram) Mean() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// Quantile 估算分位数（返回目标值所在桶的上界，落在 +Inf 桶时返回最后一个边界）
+func (h *Histogram) Quantile(q float64) float64 {
+	total := int64(0)
+	counts := make([]int64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = atomic.LoadInt64(&h.counts[i])
+		total += counts[i]
+	}
+	if total == 0 || len(h.bounds) == 0 {
+		return 0
+	}
+
+	target := int64(math.Ceil(q * float64(total)))
+	seen := int64(0)
+	for i, count := range counts {
+		seen += count
+		if seen >= target && i < len(h.bounds) {
+			return h.bounds[i]
+		}
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// writePrometheus 以 Prometheus histogram 格式输出（桶计数是累积的）
+func (h *Histogram) writePrometheus(w io.Writer, name string) {
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	cumulative := int64(0)
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadInt64(&h.counts[i])
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, cumulative)
+	}
+	cumulative += atomic.LoadInt64(&h.counts[len(h.bounds)])
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+
+	h.mu.Lock()
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.total)
+	h.mu.Unlock()
+}
+
+// ============================================
+// 演示: 延迟变高是不是限流造成的？
+// ============================================
+
+func metricsDemo() {
+	fmt.Println("📍 指标演示: 每秒 10 个请求，突发容量 3，连续 Wait 8 次")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	metrics := NewLimiterMetrics()
+	limiter := NewTokenBucket(10, 3)
+	limiter.SetMetrics(metrics)
+	limiter.SetTrace(func(event LimiterEvent) {
+		if event.Waited > 0 {
+			fmt.Printf("  🔎 %s 等待了 %v（判断前剩余 %.2f 个令牌）\n",
+				event.Op, event.Waited.Round(time.Millisecond), event.Tokens)
+		}
+	})
+
+	for i := 0; i < 8; i++ {
+		limiter.Wait()
+	}
+	limiter.Allow()
+
+	fmt.Printf("  放行 %d / 拒绝 %d / 等待后放行 %d\n",
+		atomic.LoadInt64(&metrics.Allowed), atomic.LoadInt64(&metrics.Rejected), atomic.LoadInt64(&metrics.Waited))
+	fmt.Printf("  平均等待: %.0fms, P90 等待 <= %gs\n",
+		metrics.WaitTime.Mean()*1000, metrics.WaitTime.Quantile(0.9))
+	fmt.Println("💡 等待时间直方图偏高，说明延迟来自我们自己的限流，而不是下游")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterMetricsRecordClassifiesEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		event LimiterEvent
+		want  [4]int64 // Allowed, Rejected, Waited, Cancelled
+	}{
+		{"allow 成功", LimiterEvent{Op: "allow", Allowed: true}, [4]int64{1, 0, 0, 0}},
+		{"allow 失败", LimiterEvent{Op: "allow"}, [4]int64{0, 1, 0, 0}},
+		{"wait 无需等待", LimiterEvent{Op: "wait", Allowed: true}, [4]int64{1, 0, 0, 0}},
+		{"wait 等待后放行", LimiterEvent{Op: "wait", Allowed: true, Waited: time.Millisecond}, [4]int64{0, 0, 1, 0}},
+		{"wait 被取消", LimiterEvent{Op: "wait", Err: context.Canceled}, [4]int64{0, 0, 0, 1}},
+		{"wait 超时", LimiterEvent{Op: "wait", Err: context.DeadlineExceeded}, [4]int64{0, 0, 0, 1}},
+		{"wait 超过容量", LimiterEvent{Op: "wait", Err: errors.New("超过了桶的容量")}, [4]int64{0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewLimiterMetrics()
+			m.Record(tt.event)
+			got := [4]int64{m.Allowed, m.Rejected, m.Waited, m.Cancelled}
+			if got != tt.want {
+				t.Errorf("计数 (放行, 拒绝, 等待后放行, 取消) = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiterMetricsRecordsHistograms(t *testing.T) {
+	m := NewLimiterMetrics()
+	m.Record(LimiterEvent{Op: "allow", Allowed: true, Tokens: 2, Capacity: 4})
+	m.Record(LimiterEvent{Op: "wait", Allowed: true, Waited: 20 * time.Millisecond, Tokens: 0, Capacity: 4})
+	m.Record(LimiterEvent{Op: "wait", Err: errors.New("超过了桶的容量"), Tokens: 4, Capacity: 4})
+
+	// 只有真正排过队的 wait 计入等待时间
+	if got := m.WaitTime.Count(); got != 1 {
+		t.Errorf("WaitTime.Count() = %d，期望 1", got)
+	}
+	if got := m.WaitTime.Mean(); math.Abs(got-0.02) > 1e-9 {
+		t.Errorf("WaitTime.Mean() = %v，期望 0.02", got)
+	}
+	if got := m.FillLevel.Count(); got != 2 {
+		t.Errorf("FillLevel.Count() = %d，期望 2", got)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram(1, 2, 5)
+	if got := h.Quantile(0.5); got != 0 {
+		t.Errorf("空直方图 Quantile(0.5) = %v，期望 0", got)
+	}
+
+	// 1 个落在 (-Inf,1]，2 个落在 (1,2]，1 个落在 (2,5]，1 个落在 +Inf 桶
+	for _, v := range []float64{0.5, 1.5, 2, 4, 100} {
+		h.Observe(v)
+	}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 1},
+		{0.2, 1},
+		{0.21, 2},
+		{0.6, 2},
+		{0.8, 5},
+		{0.99, 5}, // 落在 +Inf 桶，返回最后一个边界
+		{1, 5},
+	}
+	for _, tt := range tests {
+		if got := h.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%v) = %v，期望 %v", tt.q, got, tt.want)
+		}
+	}
+	if got, want := h.Mean(), (0.5+1.5+2+4+100)/5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Mean() = %v，期望 %v", got, want)
+	}
+}
+
+func TestLimiterMetricsWritePrometheus(t *testing.T) {
+	m := &LimiterMetrics{
+		WaitTime:  NewHistogram(0.1, 1),
+		FillLevel: NewHistogram(0.5, 1),
+	}
+	m.Record(LimiterEvent{Op: "allow", Allowed: true, Tokens: 1, Capacity: 2})
+	m.Record(LimiterEvent{Op: "allow", Tokens: 0, Capacity: 2})
+	m.Record(LimiterEvent{Op: "wait", Allowed: true, Waited: 500 * time.Millisecond, Tokens: 0, Capacity: 2})
+	m.Record(LimiterEvent{Op: "wait", Err: context.Canceled, Waited: 2 * time.Second, Tokens: 0, Capacity: 2})
+
+	var b strings.Builder
+	m.WritePrometheus(&b, "api_limiter")
+
+	want := `# TYPE api_limiter_decisions_total counter
+api_limiter_decisions_total{result="allowed"} 1
+api_limiter_decisions_total{result="rejected"} 1
+api_limiter_decisions_total{result="waited"} 1
+api_limiter_decisions_total{result="cancelled"} 1
+# TYPE api_limiter_wait_seconds histogram
+api_limiter_wait_seconds_bucket{le="0.1"} 0
+api_limiter_wait_seconds_bucket{le="1"} 1
+api_limiter_wait_seconds_bucket{le="+Inf"} 2
+api_limiter_wait_seconds_sum 2.5
+api_limiter_wait_seconds_count 2
+# TYPE api_limiter_fill_ratio histogram
+api_limiter_fill_ratio_bucket{le="0.5"} 4
+api_limiter_fill_ratio_bucket{le="1"} 4
+api_limiter_fill_ratio_bucket{le="+Inf"} 4
+api_limiter_fill_ratio_sum 0.5
+api_limiter_fill_ratio_count 4
+`
+	if got := b.String(); got != want {
+		t.Errorf("WritePrometheus 输出:\n%s\n期望:\n%s", got, want)
+	}
+}
+
+func TestWaitNRecordsCapacityRejection(t *testing.T) {
+	m := NewLimiterMetrics()
+	var traced []LimiterEvent
+	limiter := NewTokenBucket(10, 2)
+	limiter.SetMetrics(m)
+	limiter.SetTrace(func(event LimiterEvent) { traced = append(traced, event) })
+
+	err := limiter.WaitN(context.Background(), 3)
+	if err == nil {
+		t.Fatal("WaitN(3) 超过容量 2，应该返回错误")
+	}
+	if got := atomic.LoadInt64(&m.Rejected); got != 1 {
+		t.Errorf("Rejected = %d，期望 1", got)
+	}
+	if got := atomic.LoadInt64(&m.Cancelled); got != 0 {
+		t.Errorf("Cancelled = %d，期望 0", got)
+	}
+	if len(traced) != 1 {
+		t.Fatalf("追踪回调收到 %d 个事件，期望 1", len(traced))
+	}
+	if event := traced[0]; event.Op != "wait" || event.Allowed || event.N != 3 || event.Capacity != 2 || event.Err == nil {
+		t.Errorf("追踪事件 = %+v，期望一次 N=3、Capacity=2 的失败 wait", event)
+	}
+}
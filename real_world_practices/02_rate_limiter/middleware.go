@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+🌐 HTTP 限流中间件
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+思考题 3 的答案：限流器通常放在中间件或网关里。
+请求进来先过限流器，拿不到令牌直接返回 429，根本不会打到业务代码。
+
+响应头约定（参考 IETF RateLimit header 草案）:
+- RateLimit-Limit:     桶的容量
+- RateLimit-Remaining: 桶里还剩多少令牌
+- RateLimit-Reset:     多少秒后桶会重新装满
+- Retry-After:         被拒绝时，多少秒后可以重试（只在 429 时返回）
+*/
+
+// KeyFunc 从请求中提取限流 key
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP 按客户端 IP 限流
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader 按请求头限流（比如 X-API-Key、X-User-ID）
+// 请求没带这个头时退化为按 IP 限流
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(name); value != "" {
+			return value
+		}
+		return KeyByIP(r)
+	}
+}
+
+// KeyByRoute 按接口限流（方法 + 路径）
+func KeyByRoute(r *http.Request) string {
+	return r.Method + " " + r.URL.Path
+}
+
+// RateLimitMiddleware 所有请求共用一个限流器
+func RateLimitMiddleware(limiter *TokenBucket) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveRateLimited(w, r, next, limiter)
+		})
+	}
+}
+
+// KeyedRateLimitMiddleware 按 keyFunc 提取的 key 分别限流
+func KeyedRateLimitMiddleware(limiters *KeyedLimiter, keyFunc KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveRateLimited(w, r, next, limiters.Get(keyFunc(r)))
+		})
+	}
+}
+
+// serveRateLimited 尝试获取令牌，写限流响应头，拿不到令牌就返回 429
+func serveRateLimited(w http.ResponseWriter, r *http.Request, next http.Handler, limiter *TokenBucket) {
+	allowed := limiter.Allow()
+
+	limit := limiter.Limit()
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(limiter.Remaining()))
+	header.Set("RateLimit-Reset", ceilSeconds(limiter.Delay(limit)))
+
+	if !allowed {
+		// 攒够一个令牌就可以重试
+		header.Set("Retry-After", ceilSeconds(limiter.Delay(1)))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// ceilSeconds 把时间向上取整成秒（HTTP 头里只能写整数秒）
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
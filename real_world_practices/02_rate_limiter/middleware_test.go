@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	limiter := NewTokenBucket(1, 3) // 每秒 1 个，突发 3 个：头里的秒数都是整数，结果稳定
+	handler := RateLimitMiddleware(limiter)(okHandler)
+
+	tests := []struct {
+		code       int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{http.StatusOK, "2", "1", ""},
+		{http.StatusOK, "1", "2", ""},
+		{http.StatusOK, "0", "3", ""},
+		{http.StatusTooManyRequests, "0", "3", "1"},
+	}
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+
+		header := rec.Header()
+		if rec.Code != tt.code {
+			t.Errorf("请求 %d: 状态码 = %d，期望 %d", i+1, rec.Code, tt.code)
+		}
+		if got := header.Get("RateLimit-Limit"); got != "3" {
+			t.Errorf("请求 %d: RateLimit-Limit = %q，期望 \"3\"", i+1, got)
+		}
+		if got := header.Get("RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("请求 %d: RateLimit-Remaining = %q，期望 %q", i+1, got, tt.remaining)
+		}
+		if got := header.Get("RateLimit-Reset"); got != tt.reset {
+			t.Errorf("请求 %d: RateLimit-Reset = %q，期望 %q", i+1, got, tt.reset)
+		}
+		if got := header.Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("请求 %d: Retry-After = %q，期望 %q", i+1, got, tt.retryAfter)
+		}
+	}
+}
+
+func TestKeyedRateLimitMiddlewareIsolatesKeys(t *testing.T) {
+	newRequest := func(method, path, remoteAddr, apiKey string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		keyFunc KeyFunc
+		first   *http.Request
+		same    *http.Request // 和 first 是同一个 key，应该被拒绝
+		other   *http.Request // 不同的 key，有自己的令牌桶
+	}{
+		{
+			name:    "KeyByIP",
+			keyFunc: KeyByIP,
+			first:   newRequest("GET", "/a", "10.0.0.1:1111", ""),
+			same:    newRequest("GET", "/b", "10.0.0.1:2222", ""), // 端口不同，IP 相同
+			other:   newRequest("GET", "/a", "10.0.0.2:1111", ""),
+		},
+		{
+			name:    "KeyByHeader",
+			keyFunc: KeyByHeader("X-API-Key"),
+			first:   newRequest("GET", "/a", "10.0.0.1:1111", "alice"),
+			same:    newRequest("GET", "/b", "10.0.0.2:1111", "alice"),
+			other:   newRequest("GET", "/a", "10.0.0.1:1111", "bob"),
+		},
+		{
+			name:    "KeyByHeader 没有头时按 IP",
+			keyFunc: KeyByHeader("X-API-Key"),
+			first:   newRequest("GET", "/a", "10.0.0.1:1111", ""),
+			same:    newRequest("GET", "/a", "10.0.0.1:2222", ""),
+			other:   newRequest("GET", "/a", "10.0.0.2:1111", ""),
+		},
+		{
+			name:    "KeyByRoute",
+			keyFunc: KeyByRoute,
+			first:   newRequest("GET", "/orders", "10.0.0.1:1111", ""),
+			same:    newRequest("GET", "/orders", "10.0.0.2:1111", ""),
+			other:   newRequest("POST", "/orders", "10.0.0.1:1111", ""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiters := NewKeyedLimiter(1, 1)
+			defer limiters.Stop()
+			handler := KeyedRateLimitMiddleware(limiters, tt.keyFunc)(okHandler)
+
+			for _, step := range []struct {
+				label string
+				req   *http.Request
+				want  int
+			}{
+				{"first", tt.first, http.StatusOK},
+				{"same", tt.same, http.StatusTooManyRequests},
+				{"other", tt.other, http.StatusOK},
+			} {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, step.req)
+				if rec.Code != step.want {
+					t.Errorf("%s: 状态码 = %d，期望 %d", step.label, rec.Code, step.want)
+				}
+			}
+			if got := limiters.Count(); got != 2 {
+				t.Errorf("key 数量 = %d，期望 2", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+💾 限流器状态持久化
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+思考题 4 的答案：这个实现的缺点是重启后令牌会重置。
+每次重启桶都是满的，频繁发布就能绕过限额（比如一天的配额）。
+
+解决办法：定期把状态写到本地文件，启动时再读回来。
+需要保存的只有两样东西：
+- 桶里还剩多少令牌
+- 上次结算令牌的时间
+
+有了"上次结算时间"，停机期间经过的时间会在下次取令牌时自动补发，
+停机 1 秒就补 1 秒的令牌，停机 1 小时桶也最多装满，不会多发。
+
+⚠️ 速率和容量不保存：它们来自当前的配置，重启后以新配置为准。
+*/
+
+// LimiterState 一个令牌桶的状态快照
+type LimiterState struct {
+	Tokens     float64   `json:"tokens"`      // 剩余令牌数
+	LastRefill time.Time `json:"last_refill"` // 上次结算令牌的时间（墙上时间）
+}
+
+// LimiterCheckpoint 写入文件的完整快照
+type LimiterCheckpoint struct {
+	SavedAt time.Time               `json:"saved_at"`
+	Global  *LimiterState           `json:"global,omitempty"` // 全局限流器
+	Keys    map[string]LimiterState `json:"keys,omitempty"`   // 按 key 限流的各个桶
+}
+
+// Snapshot 导出当前状态
+func (tb *TokenBucket) Snapshot() LimiterState {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.state.Refill(time.Now())
+	return LimiterState{
+		Tokens:     tb.state.Tokens,
+		LastRefill: tb.state.Last.Round(0), // 去掉单调时钟读数，只保留墙上时间
+	}
+}
+
+// Restore 从快照恢复状态
+// 快照之后经过的时间会按当前速率补发令牌，最多补满
+func (tb *TokenBucket) Restore(state LimiterState) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	last := state.LastRefill
+	if last.After(now) {
+		last = now // 时钟回拨时不补发，也不让令牌"欠账"
+	}
+
+	tb.state.Tokens = state.Tokens
+	if tb.state.Tokens > float64(tb.state.Capacity) {
+		tb.state.Tokens = float64(tb.state.Capacity) // 新配置的容量变小了
+	}
+	tb.state.Last = last
+	tb.state.Refill(now)
+	tb.notifyChanged()
+}
+
+// Snapshot 导出所有 key 的状态
+func (kl *KeyedLimiter) Snapshot() map[string]LimiterState {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	states := make(map[string]LimiterState, len(kl.limiters))
+	for key, entry := range kl.limiters {
+		states[key] = entry.limiter.Snapshot()
+	}
+	return states
+}
+
+// Restore 从快照恢复各个 key 的状态
+func (kl *KeyedLimiter) Restore(states map[string]LimiterState) {
+	for key, state := range states {
+		kl.Get(key).Restore(state)
+	}
+}
+
+// SaveCheckpoint 把快照写入文件
+func SaveCheckpoint(path string, checkpoint LimiterCheckpoint) error {
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化限流器状态失败: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("保存限流器状态失败: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic 先写临时文件再 rename，避免写到一半进程被杀留下损坏的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // rename 成功后这里会失败，忽略即可
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadCheckpoint 从文件读取快照
+// 文件不存在时返回空快照（第一次启动）
+func LoadCheckpoint(path string) (LimiterCheckpoint, error) {
+	var checkpoint LimiterCheckpoint
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("读取限流器状态失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("解析限流器状态 %s 失败: %w", path, err)
+	}
+	return checkpoint, nil
+}
+
+// Checkpointer 定期把限流器状态保存到文件
+type Checkpointer struct {
+	path     string
+	global   *TokenBucket  // 可以为 nil
+	keyed    *KeyedLimiter // 可以为 nil
+	interval time.Duration
+
+	// OnError 后台保存失败时回调（可选，需在 Start 之前设置）
+	OnError func(err error)
+
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCheckpointer 创建定期保存器，global 和 keyed 都可以传 nil
+func NewCheckpointer(path string, global *TokenBucket, keyed *KeyedLimiter, interval time.Duration) *Checkpointer {
+	return &Checkpointer{
+		path:     path,
+		global:   global,
+		keyed:    keyed,
+		interval: interval,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Start 从文件恢复状态，然后启动后台定期保存
+func (cp *Checkpointer) Start() error {
+	checkpoint, err := LoadCheckpoint(cp.path)
+	if err != nil {
+		return err
+	}
+	if cp.global != nil && checkpoint.Global != nil {
+		cp.global.Restore(*checkpoint.Global)
+	}
+	if cp.keyed != nil && checkpoint.Keys != nil {
+		cp.keyed.Restore(checkpoint.Keys)
+	}
+
+	go cp.saveLoop()
+
+	return nil
+}
+
+// Save 立即保存一次
+func (cp *Checkpointer) Save() error {
+	checkpoint := LimiterCheckpoint{SavedAt: time.Now().Round(0)}
+	if cp.global != nil {
+		state := cp.global.Snapshot()
+		checkpoint.Global = &state
+	}
+	if cp.keyed != nil {
+		checkpoint.Keys = cp.keyed.Snapshot()
+	}
+	return SaveCheckpoint(cp.path, checkpoint)
+}
+
+// Stop 停止后台保存，并在退出前保存最后一次
+func (cp *Checkpointer) Stop() error {
+	var err error
+	cp.stopOnce.Do(func() {
+		close(cp.done)
+		<-cp.stopped
+		err = cp.Save()
+	})
+	return err
+}
+
+// saveLoop 后台定期保存
+func (cp *Checkpointer) saveLoop() {
+	defer close(cp.stopped)
+
+	ticker := time.NewTicker(cp.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := cp.Save(); err != nil && cp.OnError != nil {
+				cp.OnError(err)
+			}
+		case <-cp.done:
+			return
+		}
+	}
+}
+
+// ============================================
+// 演示: 重启后令牌不会重置
+// ============================================
+
+func persistenceDemo() {
+	fmt.Println("📍 持久化演示: 每秒 1 个请求，突发容量 5")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	path := filepath.Join(os.TempDir(), "rate_limiter_state.json")
+	defer os.Remove(path)
+
+	// 第一次"启动"：用光所有令牌后退出
+	limiter := NewTokenBucket(1, 5)
+	checkpointer := NewCheckpointer(path, limiter, nil, time.Second)
+	if err := checkpointer.Start(); err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+	for limiter.Allow() {
+	}
+	fmt.Printf("  第 1 次运行: 用光令牌，剩余 %d\n", limiter.Remaining())
+	if err := checkpointer.Stop(); err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+
+	// 模拟停机 2 秒后重新"启动"
+	time.Sleep(2 * time.Second)
+	restarted := NewTokenBucket(1, 5)
+	fmt.Printf("  重启后（不恢复）: 剩余 %d ← 桶又满了，可以绕过限额！\n", restarted.Remaining())
+
+	checkpointer = NewCheckpointer(path, restarted, nil, time.Second)
+	if err := checkpointer.Start(); err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+	defer checkpointer.Stop()
+	fmt.Printf("  重启后（恢复状态）: 剩余 %d ← 只补发了停机 2 秒期间的令牌\n", restarted.Remaining())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomicRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{`{"tokens": 1}`, `{"tokens": 2}`} {
+		if err := writeFileAtomic(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("读回 %q，期望 %q", data, content)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("目录里有 %d 个文件，临时文件没有清理干净", len(entries))
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	empty, err := LoadCheckpoint(path)
+	if err != nil || empty.Global != nil || empty.Keys != nil {
+		t.Fatalf("文件不存在时 LoadCheckpoint = (%+v, %v)，期望空快照", empty, err)
+	}
+
+	saved := LimiterCheckpoint{
+		SavedAt: time.Now().Round(0),
+		Global:  &LimiterState{Tokens: 1.5, LastRefill: time.Now().Round(0)},
+		Keys:    map[string]LimiterState{"alice": {Tokens: 2, LastRefill: time.Now().Round(0)}},
+	}
+	if err := SaveCheckpoint(path, saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Global == nil || loaded.Global.Tokens != 1.5 || !loaded.Global.LastRefill.Equal(saved.Global.LastRefill) {
+		t.Errorf("全局状态读回 %+v，期望 %+v", loaded.Global, saved.Global)
+	}
+	if alice := loaded.Keys["alice"]; alice.Tokens != 2 {
+		t.Errorf("alice 的令牌读回 %v，期望 2", alice.Tokens)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"global":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCheckpoint(path); err == nil {
+		t.Error("文件损坏时 LoadCheckpoint 应该返回错误")
+	}
+}
+
+func TestRestoreRefillsDowntime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		capacity int
+		state    LimiterState
+		want     float64
+	}{
+		{"补发停机期间的令牌", 5, LimiterState{Tokens: 1, LastRefill: now.Add(-200 * time.Millisecond)}, 3},
+		{"停机很久也最多补满", 5, LimiterState{Tokens: 0, LastRefill: now.Add(-time.Hour)}, 5},
+		{"新容量比快照里的令牌少", 3, LimiterState{Tokens: 8, LastRefill: now}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewTokenBucket(10, tt.capacity)
+			limiter.Restore(tt.state)
+			if got := limiter.Snapshot().Tokens; math.Abs(got-tt.want) > 0.2 {
+				t.Errorf("恢复后有 %.2f 个令牌，期望约 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreFromFutureSnapshot(t *testing.T) {
+	limiter := NewTokenBucket(10, 5)
+
+	// 快照时间比现在晚一小时（时钟被往回拨了）
+	limiter.Restore(LimiterState{Tokens: 2, LastRefill: time.Now().Add(time.Hour)})
+	if got := limiter.Snapshot().Tokens; math.Abs(got-2) > 0.2 {
+		t.Errorf("恢复后有 %.2f 个令牌，期望约 2（不补发）", got)
+	}
+
+	// 也不能"欠账"：之后照常按速率补发，而不是等一小时
+	time.Sleep(200 * time.Millisecond)
+	if got := limiter.Snapshot().Tokens; got < 3.5 {
+		t.Errorf("200ms 后只有 %.2f 个令牌，补发被回拨的时钟卡住了", got)
+	}
+}
+
+func TestCheckpointerRestoresOnStartAndSavesOnStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	global := NewTokenBucket(1, 5)
+	keyed := NewKeyedLimiter(1, 5)
+	defer keyed.Stop()
+	checkpointer := NewCheckpointer(path, global, keyed, time.Hour)
+	if err := checkpointer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	global.AllowN(5)
+	keyed.Get("alice").AllowN(4)
+	if err := checkpointer.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启：新的限流器是满的，Start 之后应该回到保存时的状态
+	restartedGlobal := NewTokenBucket(1, 5)
+	restartedKeyed := NewKeyedLimiter(1, 5)
+	defer restartedKeyed.Stop()
+	restarted := NewCheckpointer(path, restartedGlobal, restartedKeyed, time.Hour)
+	if err := restarted.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Stop()
+
+	if got := restartedGlobal.Remaining(); got != 0 {
+		t.Errorf("重启后全局剩余 %d 个令牌，期望 0", got)
+	}
+	if got := restartedKeyed.Get("alice").Remaining(); got != 1 {
+		t.Errorf("重启后 alice 剩余 %d 个令牌，期望 1", got)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+🥇 按优先级排队的限流器
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+TokenBucket.Wait 对所有调用方一视同仁：
+后台重建索引的任务一口气排了 1000 个请求，用户点一下按钮也得排在后面。
+
+PriorityLimiter 在 TokenBucket 前面加了一层"分诊台"：
+- 令牌紧张时，先发给高优先级的请求
+- 低优先级可以配置"保底份额"，比如 20%：
+  只要它还在排队，每 5 个令牌至少有 1 个给它，不会被彻底饿死
+
+🔨 实现思路:
+1. 每个优先级一个 FIFO 队列（container/list，放弃等待的请求直接从队列中间删掉）
+2. 后台 goroutine：有人排队时从 TokenBucket 拿一个令牌，再决定发给谁
+3. 保底份额用"积分"实现：每发出一个令牌，正在排队的类别积累 share 分，
+   积分满 1 分的类别优先拿到这个令牌（扣 1 分），否则发给优先级最高的类别
+*/
+
+// Priority 优先级，数值越大越优先
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // 后台任务：重建索引、数据同步
+	PriorityNormal                 // 普通请求
+	PriorityHigh                   // 用户正在等待的请求
+
+	numPriorities = 3
+)
+
+// String 返回优先级的名字
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("priority(%d)", int(p))
+	}
+}
+
+// priorityWaiter 一个排队中的请求
+type priorityWaiter struct {
+	ready chan struct{} // 拿到令牌时关闭（持有锁时关闭，和出队是同一步）
+}
+
+// PriorityLimiter 按优先级发放令牌的限流器
+type PriorityLimiter struct {
+	limiter *TokenBucket
+	shares  [numPriorities]float64 // 每个优先级的保底份额（0~1）
+
+	mu      sync.Mutex
+	queues  [numPriorities]*list.List // 排队中的 *priorityWaiter
+	credits [numPriorities]float64    // 保底份额积累的积分
+
+	notify   chan struct{} // 有新请求排队时通知后台 goroutine
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPriorityLimiter 创建按优先级排队的限流器
+// shares: 各优先级的保底份额，比如 {PriorityLow: 0.2} 表示低优先级排队时至少拿到 20% 的令牌
+// 份额不能为负，所有份额之和必须小于 1（剩下的部分按优先级高低分配），否则返回错误
+func NewPriorityLimiter(limiter *TokenBucket, shares map[Priority]float64) (*PriorityLimiter, error) {
+	pl := &PriorityLimiter{
+		limiter: limiter,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for p := range pl.queues {
+		pl.queues[p] = list.New()
+	}
+
+	total := 0.0
+	for priority, share := range shares {
+		if priority < 0 || priority >= numPriorities {
+			return nil, fmt.Errorf("未知的优先级 %d", int(priority))
+		}
+		if !(share >= 0) { // NaN 也会被拒绝
+			return nil, fmt.Errorf("%v 的保底份额不能为负数，当前为 %v", priority, share)
+		}
+		pl.shares[priority] = share
+		total += share
+	}
+	if total >= 1 {
+		return nil, fmt.Errorf("保底份额之和必须小于 1，当前为 %v", total)
+	}
+
+	go pl.dispatchLoop()
+
+	return pl, nil
+}
+
+// Wait 以 priority 优先级排队等待一个令牌，ctx 取消时返回 ctx.Err()
+func (pl *PriorityLimiter) Wait(ctx context.Context, priority Priority) error {
+	if priority < 0 || priority >= numPriorities {
+		return fmt.Errorf("未知的优先级 %d", int(priority))
+	}
+
+	waiter := &priorityWaiter{ready: make(chan struct{})}
+	pl.mu.Lock()
+	elem := pl.queues[priority].PushBack(waiter)
+	pl.mu.Unlock()
+
+	select {
+	case pl.notify <- struct{}{}:
+	default:
+	}
+
+	var err error
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-pl.done:
+		err = fmt.Errorf("优先级限流器已停止")
+	}
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	select {
+	case <-waiter.ready:
+		return nil // 放弃的同时已经拿到令牌了，按成功处理
+	default:
+		pl.queues[priority].Remove(elem)
+		return err
+	}
+}
+
+// QueueLen 返回某个优先级正在排队的请求数
+func (pl *PriorityLimiter) QueueLen(priority Priority) int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.queues[priority].Len()
+}
+
+// Stop 停止后台 goroutine，排队中的请求会收到错误
+func (pl *PriorityLimiter) Stop() {
+	pl.stopOnce.Do(func() {
+		close(pl.done)
+	})
+}
+
+// dispatchLoop 有人排队时拿令牌，再按优先级发出去
+func (pl *PriorityLimiter) dispatchLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-pl.done
+		cancel()
+	}()
+
+	for {
+		if !pl.hasWaiters() {
+			select {
+			case <-pl.notify:
+				continue
+			case <-pl.done:
+				return
+			}
+		}
+
+		if err := pl.limiter.WaitN(ctx, 1); err != nil {
+			return // Stop 了
+		}
+
+		// 拿到令牌之后再挑人：等令牌期间新来的高优先级请求也能参与竞争
+		if !pl.grant() {
+			// 等令牌期间排队的人全都放弃了，令牌还回去
+			pl.limiter.refund(1)
+		}
+	}
+}
+
+// hasWaiters 是否还有人在排队
+func (pl *PriorityLimiter) hasWaiters() bool {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	for _, queue := range pl.queues {
+		if queue.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// grant 把一个令牌发给最该拿到它的请求，没有人可发时返回 false
+func (pl *PriorityLimiter) grant() bool {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	// 每发一个令牌，正在排队的类别积累一次保底积分
+	for p, queue := range pl.queues {
+		if queue.Len() > 0 {
+			pl.credits[p] += pl.shares[p]
+		} else {
+			pl.credits[p] = 0 // 不排队就不攒积分，避免之后一次性抢走一大批令牌
+		}
+	}
+
+	chosen, ok := pl.pickLocked()
+	if !ok {
+		return false
+	}
+	waiter := pl.queues[chosen].Remove(pl.queues[chosen].Front()).(*priorityWaiter)
+	if pl.credits[chosen] >= 1 {
+		pl.credits[chosen]--
+	}
+	close(waiter.ready)
+	return true
+}
+
+// pickLocked 选出这次发令牌的优先级，所有队列都空时返回 false（调用方需持有锁）
+// 保底积分满 1 分的类别优先（积分最多的先来），否则发给优先级最高的
+func (pl *PriorityLimiter) pickLocked() (Priority, bool) {
+	chosen := Priority(-1)
+	for p := numPriorities - 1; p >= 0; p-- {
+		if pl.queues[p].Len() > 0 && pl.credits[p] >= 1 {
+			if chosen < 0 || pl.credits[p] > pl.credits[chosen] {
+				chosen = Priority(p)
+			}
+		}
+	}
+	if chosen >= 0 {
+		return chosen, true
+	}
+
+	for p := numPriorities - 1; p >= 0; p-- {
+		if pl.queues[p].Len() > 0 {
+			return Priority(p), true
+		}
+	}
+	return 0, false
+}
+
+// ============================================
+// 演示: 后台任务 vs 用户请求
+// ============================================
+
+func priorityLimiterDemo() {
+	fmt.Println("📍 优先级演示: 每秒 10 个令牌，低优先级保底 20%")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	limiter := NewTokenBucket(10, 1)
+	pl, err := NewPriorityLimiter(limiter, map[Priority]float64{PriorityLow: 0.2})
+	if err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+	defer pl.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var counts [numPriorities]int64
+	var wg sync.WaitGroup
+	// 每个优先级都有 5 个 goroutine 不停地请求令牌，令牌永远不够用
+	for _, priority := range []Priority{PriorityLow, PriorityHigh} {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(p Priority) {
+				defer wg.Done()
+				for pl.Wait(ctx, p) == nil {
+					atomic.AddInt64(&counts[p], 1)
+				}
+			}(priority)
+		}
+	}
+	wg.Wait()
+
+	fmt.Printf("  high: %d 个令牌\n", counts[PriorityHigh])
+	fmt.Printf("  low:  %d 个令牌（保底 20%%，不会被饿死）\n", counts[PriorityLow])
+}
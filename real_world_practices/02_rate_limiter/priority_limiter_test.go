@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPriorityLimiterRemovesCancelledWaiters(t *testing.T) {
+	limiter := NewTokenBucket(1, 1)
+	limiter.Allow() // 桶空了，下一个令牌要等 1 秒
+	pl, err := NewPriorityLimiter(limiter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Stop()
+
+	// 排在最前面、一直在等的高优先级请求
+	frontCtx, cancelFront := context.WithCancel(context.Background())
+	frontDone := make(chan error, 1)
+	go func() { frontDone <- pl.Wait(frontCtx, PriorityHigh) }()
+
+	// 后面 100 个低优先级请求很快就放弃了，它们都不在队首
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pl.Wait(ctx, PriorityLow); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Wait = %v，期望 context.DeadlineExceeded", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := pl.QueueLen(PriorityLow); got != 0 {
+		t.Errorf("放弃之后低优先级队列长度 = %d，期望 0", got)
+	}
+	if got := pl.QueueLen(PriorityHigh); got != 1 {
+		t.Errorf("高优先级队列长度 = %d，期望 1", got)
+	}
+
+	cancelFront()
+	if err := <-frontDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("队首 Wait = %v，期望 context.Canceled", err)
+	}
+	if got := pl.QueueLen(PriorityHigh); got != 0 {
+		t.Errorf("队首放弃之后高优先级队列长度 = %d，期望 0", got)
+	}
+}
+
+func TestPriorityLimiterServesHigherPriorityFirst(t *testing.T) {
+	limiter := NewTokenBucket(20, 1)
+	limiter.Allow()
+	pl, err := NewPriorityLimiter(limiter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	order := make(chan Priority, 2)
+	var wg sync.WaitGroup
+	for _, p := range []Priority{PriorityLow, PriorityHigh} {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			if err := pl.Wait(ctx, p); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- p
+		}(p)
+	}
+	wg.Wait()
+	close(order)
+
+	// 两个请求都在第一个令牌发出之前排上了队（令牌要等 50ms）
+	if first := <-order; first != PriorityHigh {
+		t.Errorf("第一个拿到令牌的是 %v，期望 high", first)
+	}
+}
+
+func TestNewPriorityLimiterRejectsInvalidShares(t *testing.T) {
+	tests := []struct {
+		name   string
+		shares map[Priority]float64
+	}{
+		{"负数份额", map[Priority]float64{PriorityLow: -0.1}},
+		{"NaN", map[Priority]float64{PriorityLow: math.NaN()}},
+		{"份额之和等于 1", map[Priority]float64{PriorityLow: 0.5, PriorityNormal: 0.5}},
+		{"份额之和大于 1", map[Priority]float64{PriorityLow: 0.7, PriorityNormal: 0.6}},
+		{"未知的优先级", map[Priority]float64{Priority(7): 0.1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if pl, err := NewPriorityLimiter(NewTokenBucket(10, 1), tt.shares); err == nil {
+				pl.Stop()
+				t.Errorf("NewPriorityLimiter(%v) 应该返回错误", tt.shares)
+			}
+		})
+	}
+}
+
+func TestPriorityLimiterReservesShareForLowPriority(t *testing.T) {
+	const share = 0.2
+	limiter := NewTokenBucket(200, 1)
+	pl, err := NewPriorityLimiter(limiter, map[Priority]float64{PriorityLow: share})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// 高优先级一直有 5 个请求在排队，令牌永远不够用
+	var counts [numPriorities]int64
+	var wg sync.WaitGroup
+	for _, p := range []Priority{PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh, PriorityLow} {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			for pl.Wait(ctx, p) == nil {
+				atomic.AddInt64(&counts[p], 1)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	high, low := counts[PriorityHigh], counts[PriorityLow]
+	total := high + low
+	if total < 100 {
+		t.Fatalf("一秒只发出 %d 个令牌，测试环境太慢", total)
+	}
+	if ratio := float64(low) / float64(total); ratio < share*0.75 {
+		t.Errorf("低优先级拿到 %d/%d (%.0f%%)，期望至少约 %.0f%% 的保底份额", low, total, ratio*100, share*100)
+	}
+	if high < low {
+		t.Errorf("高优先级只拿到 %d 个，比低优先级的 %d 个还少", high, low)
+	}
+}
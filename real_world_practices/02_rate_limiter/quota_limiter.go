@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+📅 日/月配额 (Quota)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+第三方 API 除了"每秒 5 次"，往往还有"每天 10000 次"：
+- 每天 0 点（按对方的时区！）重置，而不是"过去 24 小时"
+- 用到 80%、95% 的时候最好提前报警，别等被封了才发现
+
+和令牌桶的区别:
+- 令牌桶: 令牌持续补充，关心的是"速度"
+- 配额:   窗口内总量固定，到点一次性重置，关心的是"总量"
+
+🔨 实现思路:
+1. 记录当前窗口的起点和已用次数
+2. 每次使用前检查是否跨过了窗口边界（按日历对齐，time.Date 自动处理夏令时）
+3. 已用比例跨过阈值时回调一次，每个窗口每个阈值只报一次
+4. 可以叠加一个 TokenBucket：配额管总量，TokenBucket 管速度
+*/
+
+// ErrQuotaExhausted 配额已用完
+var ErrQuotaExhausted = errors.New("配额已用完")
+
+// QuotaPeriod 配额的重置周期
+type QuotaPeriod int
+
+const (
+	QuotaDaily   QuotaPeriod = iota // 每天 0 点重置
+	QuotaMonthly                    // 每月 1 号 0 点重置
+)
+
+// QuotaState 需要持久化的配额状态
+type QuotaState struct {
+	WindowStart time.Time `json:"window_start"`
+	Used        int64     `json:"used"`
+}
+
+// QuotaLimiter 按日历窗口重置的配额限制器
+type QuotaLimiter struct {
+	limit    int64
+	period   QuotaPeriod
+	location *time.Location   // 按哪个时区的 0 点重置
+	rate     *TokenBucket     // 可选：同时限制速度
+	now      func() time.Time // 当前时间，测试里可以替换
+
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int64            // 已用次数，包含 pending
+	pending     int64            // 已经占用、但还在等速率限制器的次数，不计入报警
+	thresholds  []float64        // 报警阈值（升序），比如 0.8, 0.95
+	warned      map[float64]bool // 当前窗口里已经报过的阈值
+
+	onWarning func(threshold float64, used, limit int64)
+}
+
+// NewQuotaLimiter 创建配额限制器
+// limit: 每个窗口最多多少次
+// location: 按哪个时区的日历重置，传 nil 表示本地时区
+// rate: 可选的速率限制器，传 nil 表示只限总量
+func NewQuotaLimiter(limit int64, period QuotaPeriod, location *time.Location, rate *TokenBucket) *QuotaLimiter {
+	if location == nil {
+		location = time.Local
+	}
+	ql := &QuotaLimiter{
+		limit:    limit,
+		period:   period,
+		location: location,
+		rate:     rate,
+		now:      time.Now,
+		warned:   make(map[float64]bool),
+	}
+	ql.windowStart = ql.windowFor(ql.now())
+	return ql
+}
+
+// OnWarning 设置用量报警：已用比例第一次达到某个阈值时回调
+// 比如 OnWarning(fn, 0.8, 0.95) 会在用到 80% 和 95% 时各回调一次
+func (ql *QuotaLimiter) OnWarning(fn func(threshold float64, used, limit int64), thresholds ...float64) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	ql.onWarning = fn
+	ql.thresholds = append([]float64(nil), thresholds...)
+	sort.Float64s(ql.thresholds)
+}
+
+// Allow 尝试使用一次配额（非阻塞）
+// 配置了 TokenBucket 时两者都要满足；速率拒绝时不消耗配额，也不触发报警
+func (ql *QuotaLimiter) Allow() bool {
+	window, ok := ql.take(1)
+	if !ok {
+		return false
+	}
+	if ql.rate != nil && !ql.rate.Allow() {
+		ql.giveBack(window, 1)
+		return false
+	}
+	ql.confirm(window, 1)
+	return true
+}
+
+// Wait 使用一次配额，需要时等待速率限制器
+// 配额用完时不会等到下一个窗口，立即返回 ErrQuotaExhausted
+func (ql *QuotaLimiter) Wait(ctx context.Context) error {
+	window, ok := ql.take(1)
+	if !ok {
+		return fmt.Errorf("%w，%s 重置", ErrQuotaExhausted, ql.ResetAt().Format("2006-01-02 15:04 MST"))
+	}
+	if ql.rate != nil {
+		if err := ql.rate.WaitN(ctx, 1); err != nil {
+			ql.giveBack(window, 1)
+			return err
+		}
+	}
+	ql.confirm(window, 1)
+	return nil
+}
+
+// Remaining 返回当前窗口剩余的次数
+func (ql *QuotaLimiter) Remaining() int64 {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	ql.rollLocked(ql.now())
+	return ql.limit - ql.used
+}
+
+// ResetAt 返回下一次重置的时间
+func (ql *QuotaLimiter) ResetAt() time.Time {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	ql.rollLocked(ql.now())
+	return ql.nextWindow(ql.windowStart)
+}
+
+// State 导出当前状态，用于持久化
+func (ql *QuotaLimiter) State() QuotaState {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	ql.rollLocked(ql.now())
+	return QuotaState{WindowStart: ql.windowStart, Used: ql.used}
+}
+
+// Restore 从状态恢复
+// 如果停机期间已经跨过了窗口边界，旧的用量作废，从 0 开始
+func (ql *QuotaLimiter) Restore(state QuotaState) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	ql.windowStart = state.WindowStart.In(ql.location)
+	ql.used = state.Used + ql.pending // 还在等速率限制器的占用保留
+	ql.rollLocked(ql.now())
+
+	// 重启前已经报过的阈值不再重复报
+	for _, threshold := range ql.thresholds {
+		if float64(ql.used-ql.pending) >= threshold*float64(ql.limit) {
+			ql.warned[threshold] = true
+		}
+	}
+}
+
+// Save 把状态写入文件
+func (ql *QuotaLimiter) Save(path string) error {
+	data, err := json.MarshalIndent(ql.State(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化配额状态失败: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("保存配额状态失败: %w", err)
+	}
+	return nil
+}
+
+// Load 从文件恢复状态，文件不存在时什么也不做（第一次启动）
+func (ql *QuotaLimiter) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取配额状态失败: %w", err)
+	}
+
+	var state QuotaState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析配额状态 %s 失败: %w", path, err)
+	}
+	ql.Restore(state)
+	return nil
+}
+
+// take 先占用 n 次配额（还没确认，不触发报警），不够时返回 false
+// 返回占用时所在窗口的起点，confirm / giveBack 时用来判断窗口是否已经重置
+func (ql *QuotaLimiter) take(n int64) (time.Time, bool) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	ql.rollLocked(ql.now())
+	if ql.used+n > ql.limit {
+		return time.Time{}, false
+	}
+	ql.used += n
+	ql.pending += n
+	return ql.windowStart, true
+}
+
+// confirm 确认占用的 n 次配额（速率限制也通过了），新跨过阈值时回调报警
+func (ql *QuotaLimiter) confirm(window time.Time, n int64) {
+	ql.mu.Lock()
+	if !window.Equal(ql.windowStart) {
+		// 等速率限制器期间窗口已经重置，这次占用算在旧窗口里
+		ql.mu.Unlock()
+		return
+	}
+	ql.pending -= n
+
+	// 找出这次新跨过的阈值，回调放到锁外执行
+	confirmed := ql.used - ql.pending
+	var crossed []float64
+	for _, threshold := range ql.thresholds {
+		if !ql.warned[threshold] && float64(confirmed) >= threshold*float64(ql.limit) {
+			ql.warned[threshold] = true
+			crossed = append(crossed, threshold)
+		}
+	}
+	limit, onWarning := ql.limit, ql.onWarning
+	ql.mu.Unlock()
+
+	if onWarning != nil {
+		for _, threshold := range crossed {
+			onWarning(threshold, confirmed, limit)
+		}
+	}
+}
+
+// giveBack 归还占用的 n 次配额（速率限制没通过时）
+// 窗口已经重置时什么也不做，不能从新窗口的用量里扣
+func (ql *QuotaLimiter) giveBack(window time.Time, n int64) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	if !window.Equal(ql.windowStart) {
+		return
+	}
+	ql.used -= n
+	ql.pending -= n
+}
+
+// rollLocked 跨过窗口边界时重置用量（调用方需持有锁）
+func (ql *QuotaLimiter) rollLocked(now time.Time) {
+	current := ql.windowFor(now)
+	if current.Equal(ql.windowStart) {
+		return
+	}
+	ql.windowStart = current
+	ql.used = 0
+	ql.pending = 0
+	ql.warned = make(map[float64]bool)
+}
+
+// windowFor 返回 t 所在窗口的起点（location 时区的 0 点 / 1 号 0 点）
+func (ql *QuotaLimiter) windowFor(t time.Time) time.Time {
+	t = t.In(ql.location)
+	switch ql.period {
+	case QuotaMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, ql.location)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, ql.location)
+	}
+}
+
+// nextWindow 返回 start 之后下一个窗口的起点
+func (ql *QuotaLimiter) nextWindow(start time.Time) time.Time {
+	switch ql.period {
+	case QuotaMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// ============================================
+// 演示: 每天 10 次的配额 + 80% / 95% 报警
+// ============================================
+
+func quotaLimiterDemo() {
+	fmt.Println("📍 配额演示: 每天 10 次（按上海时间 0 点重置），每秒最多 5 次")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		shanghai = time.FixedZone("CST", 8*3600) // 系统没有时区数据库时退化为固定时区
+	}
+
+	quota := NewQuotaLimiter(10, QuotaDaily, shanghai, NewTokenBucket(5, 5))
+	quota.OnWarning(func(threshold float64, used, limit int64) {
+		fmt.Printf("  ⚠️  配额已用 %.0f%% (%d/%d)\n", threshold*100, used, limit)
+	}, 0.8, 0.95)
+
+	for i := 1; i <= 12; i++ {
+		if err := quota.Wait(context.Background()); err != nil {
+			fmt.Printf("  ❌ [请求 %2d] %v\n", i, err)
+			continue
+		}
+		fmt.Printf("  ✅ [请求 %2d] 剩余 %d 次\n", i, quota.Remaining())
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试环境不一定有系统时区数据库
+)
+
+// newTestQuota 创建使用假时钟的配额限制器，修改 *now 就能让时间前进
+func newTestQuota(t *testing.T, limit int64, period QuotaPeriod, location *time.Location, now *time.Time) *QuotaLimiter {
+	t.Helper()
+	ql := NewQuotaLimiter(limit, period, location, nil)
+	ql.now = func() time.Time { return *now }
+	ql.windowStart = ql.windowFor(*now)
+	return ql
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestQuotaLimiterRemainingAndDailyRollover(t *testing.T) {
+	shanghai := loadLocation(t, "Asia/Shanghai")
+	now := time.Date(2024, 3, 1, 23, 59, 0, 0, shanghai)
+	ql := newTestQuota(t, 3, QuotaDaily, shanghai, &now)
+
+	for i := 0; i < 3; i++ {
+		if !ql.Allow() {
+			t.Fatalf("第 %d 次 Allow 被拒绝", i+1)
+		}
+	}
+	if ql.Allow() {
+		t.Error("配额用完后 Allow 应该返回 false")
+	}
+	if got := ql.Remaining(); got != 0 {
+		t.Errorf("Remaining() = %d，期望 0", got)
+	}
+
+	// 上海时间 0 点重置
+	now = time.Date(2024, 3, 2, 0, 0, 0, 0, shanghai)
+	if got := ql.Remaining(); got != 3 {
+		t.Errorf("跨过 0 点后 Remaining() = %d，期望 3", got)
+	}
+	if !ql.Allow() {
+		t.Error("新的一天 Allow 应该成功")
+	}
+}
+
+func TestQuotaLimiterResetAt(t *testing.T) {
+	shanghai := loadLocation(t, "Asia/Shanghai")
+	newYork := loadLocation(t, "America/New_York")
+
+	tests := []struct {
+		name     string
+		period   QuotaPeriod
+		location *time.Location
+		now      time.Time
+		want     time.Time
+	}{
+		{
+			"按天",
+			QuotaDaily, shanghai,
+			time.Date(2024, 5, 20, 15, 30, 0, 0, shanghai),
+			time.Date(2024, 5, 21, 0, 0, 0, 0, shanghai),
+		},
+		{
+			// UTC 20:00 在上海已经是第二天凌晨 4 点
+			"按对方时区的日历",
+			QuotaDaily, shanghai,
+			time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 3, 0, 0, 0, 0, shanghai),
+		},
+		{
+			"同一时刻换成 UTC",
+			QuotaDaily, time.UTC,
+			time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"按月，跨过 2 月底",
+			QuotaMonthly, shanghai,
+			time.Date(2024, 2, 29, 12, 0, 0, 0, shanghai),
+			time.Date(2024, 3, 1, 0, 0, 0, 0, shanghai),
+		},
+		{
+			"按月，跨年",
+			QuotaMonthly, shanghai,
+			time.Date(2024, 12, 31, 23, 59, 0, 0, shanghai),
+			time.Date(2025, 1, 1, 0, 0, 0, 0, shanghai),
+		},
+		{
+			// 夏令时开始那天只有 23 小时
+			"夏令时开始",
+			QuotaDaily, newYork,
+			time.Date(2024, 3, 10, 12, 0, 0, 0, newYork),
+			time.Date(2024, 3, 11, 0, 0, 0, 0, newYork),
+		},
+		{
+			// 夏令时结束那天有 25 小时
+			"夏令时结束",
+			QuotaDaily, newYork,
+			time.Date(2024, 11, 3, 1, 30, 0, 0, newYork),
+			time.Date(2024, 11, 4, 0, 0, 0, 0, newYork),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			ql := newTestQuota(t, 10, tt.period, tt.location, &now)
+			if got := ql.ResetAt(); !got.Equal(tt.want) {
+				t.Errorf("ResetAt() = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaLimiterDSTDayLength(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	tests := []struct {
+		name string
+		day  time.Time
+		want time.Duration
+	}{
+		{"夏令时开始", time.Date(2024, 3, 10, 0, 0, 0, 0, newYork), 23 * time.Hour},
+		{"夏令时结束", time.Date(2024, 11, 3, 0, 0, 0, 0, newYork), 25 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.day
+			ql := newTestQuota(t, 1, QuotaDaily, newYork, &now)
+			if !ql.Allow() {
+				t.Fatal("第一次 Allow 被拒绝")
+			}
+
+			// 窗口结束前 1 秒还是同一天，到点才重置
+			now = tt.day.Add(tt.want - time.Second)
+			if ql.Allow() {
+				t.Errorf("%v 还在同一天，配额不应该重置", now)
+			}
+			now = tt.day.Add(tt.want)
+			if !ql.Allow() {
+				t.Errorf("%v 已经是第二天，配额应该重置", now)
+			}
+		})
+	}
+}
+
+func TestQuotaLimiterWarnings(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	ql := newTestQuota(t, 10, QuotaDaily, time.UTC, &now)
+
+	type warning struct {
+		threshold float64
+		used      int64
+	}
+	var got []warning
+	ql.OnWarning(func(threshold float64, used, limit int64) {
+		got = append(got, warning{threshold, used})
+	}, 0.95, 0.5) // 乱序传入也要按升序处理
+
+	for i := 0; i < 10; i++ {
+		ql.Allow()
+	}
+	want := []warning{{0.5, 5}, {0.95, 10}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("报警 = %v，期望 %v", got, want)
+	}
+
+	// 每个窗口每个阈值只报一次，新窗口重新报
+	ql.Allow()
+	if len(got) != 2 {
+		t.Errorf("同一窗口重复报警: %v", got)
+	}
+	now = now.Add(24 * time.Hour)
+	for i := 0; i < 5; i++ {
+		ql.Allow()
+	}
+	if len(got) != 3 || got[2] != (warning{0.5, 5}) {
+		t.Errorf("新窗口的报警 = %v，期望再报一次 {0.5 5}", got[2:])
+	}
+}
+
+func TestQuotaLimiterRateRejectionDoesNotWarn(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	rate := NewTokenBucket(1, 1)
+	ql := newTestQuota(t, 2, QuotaDaily, time.UTC, &now)
+	ql.rate = rate
+
+	var warnings []int64
+	ql.OnWarning(func(threshold float64, used, limit int64) {
+		warnings = append(warnings, used)
+	}, 1)
+
+	if !ql.Allow() {
+		t.Fatal("第一次 Allow 被拒绝")
+	}
+	// 速率限制器没有令牌了：配额要退回，阈值也不能算"已报过"
+	if ql.Allow() {
+		t.Fatal("速率限制器没有令牌，Allow 应该返回 false")
+	}
+	if len(warnings) != 0 {
+		t.Errorf("速率拒绝的请求触发了报警: %v", warnings)
+	}
+	if got := ql.Remaining(); got != 1 {
+		t.Errorf("速率拒绝后 Remaining() = %d，期望 1", got)
+	}
+
+	rate.refund(1)
+	if !ql.Allow() {
+		t.Fatal("速率限制器有令牌后 Allow 应该成功")
+	}
+	if len(warnings) != 1 || warnings[0] != 2 {
+		t.Errorf("报警 = %v，期望用到 2 次时报一次", warnings)
+	}
+}
+
+func TestQuotaLimiterSaveLoad(t *testing.T) {
+	shanghai := loadLocation(t, "Asia/Shanghai")
+	path := filepath.Join(t.TempDir(), "quota.json")
+	now := time.Date(2024, 6, 1, 22, 0, 0, 0, shanghai)
+
+	ql := newTestQuota(t, 10, QuotaDaily, shanghai, &now)
+	for i := 0; i < 8; i++ {
+		ql.Allow()
+	}
+	if err := ql.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("同一天重启", func(t *testing.T) {
+		restarted := newTestQuota(t, 10, QuotaDaily, shanghai, &now)
+		warned := 0
+		restarted.OnWarning(func(float64, int64, int64) { warned++ }, 0.8)
+		if err := restarted.Load(path); err != nil {
+			t.Fatal(err)
+		}
+		if got := restarted.Remaining(); got != 2 {
+			t.Errorf("Remaining() = %d，期望 2", got)
+		}
+		restarted.Allow()
+		if warned != 0 {
+			t.Error("重启前已经报过的 80% 阈值又报了一次")
+		}
+	})
+
+	t.Run("停机期间跨过了 0 点", func(t *testing.T) {
+		later := now.Add(3 * time.Hour)
+		restarted := newTestQuota(t, 10, QuotaDaily, shanghai, &later)
+		if err := restarted.Load(path); err != nil {
+			t.Fatal(err)
+		}
+		if got := restarted.Remaining(); got != 10 {
+			t.Errorf("Remaining() = %d，期望 10", got)
+		}
+	})
+
+	t.Run("文件不存在", func(t *testing.T) {
+		fresh := newTestQuota(t, 10, QuotaDaily, shanghai, &now)
+		if err := fresh.Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+			t.Errorf("第一次启动 Load 应该返回 nil，得到 %v", err)
+		}
+	})
+
+	t.Run("文件损坏", func(t *testing.T) {
+		broken := filepath.Join(t.TempDir(), "broken.json")
+		if err := os.WriteFile(broken, []byte("{"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := newTestQuota(t, 10, QuotaDaily, shanghai, &now).Load(broken); err == nil {
+			t.Error("解析失败应该返回错误")
+		}
+	})
+}
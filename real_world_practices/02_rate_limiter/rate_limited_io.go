@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+/*
+🚰 带宽限制: 限流的 io.Reader / io.Writer
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+限流不只能限"请求数"，也能限"字节数"：
+把 TokenBucket 的一个令牌看成 1 个字节，
+NewTokenBucket(1024*1024, 64*1024) 就是 1MB/s、最多突发 64KB。
+
+包装之后的 Reader / Writer 每读写 n 个字节就 WaitN(n) 个令牌。
+多个 Reader 共用同一个 TokenBucket，就是多个下载任务共享总带宽。
+
+⚠️ 为什么要分块？
+一次 Read 可能要 1MB，而桶的容量只有 64KB —— WaitN(1MB) 永远等不到。
+就算等得到，也会变成"停 1 秒、猛传 1MB、再停 1 秒"。
+所以每次最多只读写"桶容量"那么多字节，流量才平滑。
+*/
+
+// chunkSize 每次最多读写多少字节（桶的容量）
+// 容量小于 1（比如 NewTokenBucket(rate, 0)）时一个字节也拿不到令牌，返回错误而不是返回 0 让 io.Copy 空转
+func chunkSize(limiter *TokenBucket) (int, error) {
+	size := limiter.Limit()
+	if size < 1 {
+		return 0, fmt.Errorf("限流器的突发容量为 %d，一个字节也读写不了", size)
+	}
+	return size, nil
+}
+
+// Reader 限速的 io.Reader
+type Reader struct {
+	r       io.Reader
+	limiter *TokenBucket
+	ctx     context.Context
+}
+
+// NewReader 包装 r，读取速度不超过 limiter 的速率（每个令牌 = 1 字节）
+func NewReader(r io.Reader, limiter *TokenBucket) *Reader {
+	return NewReaderContext(context.Background(), r, limiter)
+}
+
+// NewReaderContext 同 NewReader，ctx 取消时 Read 返回 ctx.Err()
+func NewReaderContext(ctx context.Context, r io.Reader, limiter *TokenBucket) *Reader {
+	return &Reader{r: r, limiter: limiter, ctx: ctx}
+}
+
+// Read 实现 io.Reader：先读，再为读到的字节数付令牌
+func (lr *Reader) Read(p []byte) (int, error) {
+	chunk, err := chunkSize(lr.limiter)
+	if err != nil {
+		return 0, err
+	}
+	if len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if waitErr := lr.limiter.WaitN(lr.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Writer 限速的 io.Writer
+type Writer struct {
+	w       io.Writer
+	limiter *TokenBucket
+	ctx     context.Context
+}
+
+// NewWriter 包装 w，写入速度不超过 limiter 的速率（每个令牌 = 1 字节）
+func NewWriter(w io.Writer, limiter *TokenBucket) *Writer {
+	return NewWriterContext(context.Background(), w, limiter)
+}
+
+// NewWriterContext 同 NewWriter，ctx 取消时 Write 返回 ctx.Err()
+func NewWriterContext(ctx context.Context, w io.Writer, limiter *TokenBucket) *Writer {
+	return &Writer{w: w, limiter: limiter, ctx: ctx}
+}
+
+// Write 实现 io.Writer：按桶容量分块，每块先拿令牌再写
+func (lw *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		size, err := chunkSize(lw.limiter)
+		if err != nil {
+			return written, err
+		}
+		chunk := p[written:]
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+
+		if err := lw.limiter.WaitN(lw.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := lw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
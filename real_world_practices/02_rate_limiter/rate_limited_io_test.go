@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReaderWriterFailWhenBurstIsZero(t *testing.T) {
+	limiter := NewTokenBucket(1024, 0)
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(io.Discard, NewReader(bytes.NewReader(make([]byte, 1024)), limiter))
+		done <- err
+	}()
+	go func() {
+		_, err := NewWriter(io.Discard, limiter).Write(make([]byte, 1024))
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("突发容量为 0 时应该返回错误")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("突发容量为 0 时读写卡住了")
+		}
+	}
+}
+
+func TestReaderLimitsThroughput(t *testing.T) {
+	limiter := NewTokenBucket(10*1024, 1024) // 10KB/s，突发 1KB
+	data := bytes.Repeat([]byte("x"), 3*1024)
+
+	start := time.Now()
+	var out bytes.Buffer
+	n, err := io.Copy(&out, NewReader(bytes.NewReader(data), limiter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("读到 %d 字节，内容不一致", n)
+	}
+	// 突发的 1KB 立即可用，剩下 2KB 需要大约 200ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("3KB 只用了 %v，没有限速", elapsed)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+🧱 Redis 作为令牌权威方
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+如果机器上已经有 Redis（或者 KeyDB、Dragonfly 等兼容 Redis 协议的服务），
+就不用再单独部署 token_server.go 了（需要 Redis 5 及以上，原因见 redisLeaseScript）。
+
+令牌桶的状态存在一个 Hash 里: {tokens, ts}
+领取令牌用一段 Lua 脚本完成，Redis 保证脚本原子执行，
+所以多个进程同时领取也不会超发。
+
+为了不引入第三方库，这里手写了一个最小的 RESP 协议客户端，只支持本文件用到的命令。
+*/
+
+// redisLeaseScript 领取令牌的 Lua 脚本
+// KEYS[1]: 桶的 key
+// ARGV: 每毫秒发放多少令牌, 桶容量, 申请数量, key 的过期毫秒数
+// 返回: {领到的数量, 再攒一个令牌需要的毫秒数}
+//
+// ⚠️ 脚本先调用 TIME 再写数据，需要 Redis 按"效果"复制脚本（effects replication）：
+// Redis 5 起默认如此；3.2 ~ 4.x 默认按脚本原文复制，从库重放时 TIME 的结果不同，会拒绝执行这段脚本。
+// 兼容 Redis 协议的其他服务也要支持效果复制才能用。
+const redisLeaseScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local want = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) * rate)
+else
+  now = ts
+end
+local granted = math.min(want, math.floor(tokens))
+tokens = tokens - granted
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+local retry = 0
+if tokens < 1 then
+  retry = math.ceil((1 - tokens) / rate)
+end
+return {granted, retry}
+`
+
+// redisReleaseScript 归还令牌的 Lua 脚本（最多补满，不会超过桶容量）
+// KEYS[1]: 桶的 key
+// ARGV: 桶容量, 归还数量
+const redisReleaseScript = `
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+if tokens == nil then
+  return 0
+end
+tokens = math.min(tonumber(ARGV[1]), tokens + tonumber(ARGV[2]))
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens))
+return 1
+`
+
+// RedisAuthority 用 Redis 做权威方，实现了 TokenAuthority
+type RedisAuthority struct {
+	addr      string
+	rate      float64 // 每秒发放多少令牌
+	burstSize int
+	leaseTTL  time.Duration
+	keyPrefix string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisAuthority 创建 Redis 权威方
+// 所有进程必须使用相同的 requestsPerSecond / burstSize，否则以最后写入的为准
+func NewRedisAuthority(addr string, requestsPerSecond float64, burstSize int, leaseTTL time.Duration) *RedisAuthority {
+	return &RedisAuthority{
+		addr:      addr,
+		rate:      requestsPerSecond,
+		burstSize: burstSize,
+		leaseTTL:  leaseTTL,
+		keyPrefix: "ratelimit:",
+	}
+}
+
+// Lease 申请最多 n 个令牌
+func (r *RedisAuthority) Lease(ctx context.Context, key string, n int) (Lease, error) {
+	start := time.Now()
+	// 桶空闲足够久就会自动装满，key 保留这么久就够了，之后让 Redis 自动删除
+	idleTTL := time.Duration(float64(r.burstSize)/r.rate*float64(time.Second)) + time.Minute
+
+	reply, err := r.do(ctx, "EVAL", redisLeaseScript, "1", r.keyPrefix+key,
+		strconv.FormatFloat(r.rate/1000, 'g', -1, 64),
+		strconv.Itoa(r.burstSize),
+		strconv.Itoa(n),
+		strconv.FormatInt(idleTTL.Milliseconds(), 10),
+	)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Lease{}, fmt.Errorf("redis 返回格式不对: %v", reply)
+	}
+	granted, _ := values[0].(int64)
+	retry, _ := values[1].(int64)
+
+	// 租约只在客户端生效：Redis 里的令牌已经扣掉了，过期没用完就作废
+	return Lease{
+		Granted:    int(granted),
+		ExpiresAt:  start.Add(r.leaseTTL),
+		RetryAfter: time.Duration(retry) * time.Millisecond,
+	}, nil
+}
+
+// Release 归还 n 个令牌
+func (r *RedisAuthority) Release(ctx context.Context, key string, n int) error {
+	_, err := r.do(ctx, "EVAL", redisReleaseScript, "1", r.keyPrefix+key,
+		strconv.Itoa(r.burstSize),
+		strconv.Itoa(n),
+	)
+	return err
+}
+
+// Close 关闭连接
+func (r *RedisAuthority) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// do 发送一条命令并读取响应
+func (r *RedisAuthority) do(ctx context.Context, args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+		if err != nil {
+			return nil, fmt.Errorf("连接 redis 失败: %w", err)
+		}
+		r.conn = conn
+		r.reader = bufio.NewReader(conn)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	r.conn.SetDeadline(deadline)
+
+	if _, err := r.conn.Write(encodeRESPCommand(args)); err != nil {
+		r.conn.Close()
+		r.conn = nil
+		return nil, fmt.Errorf("redis 通信失败: %w", err)
+	}
+	reply, err := readRESP(r.reader)
+	if err != nil {
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			// 网络或协议错误，连接状态未知，下次重连
+			r.conn.Close()
+			r.conn = nil
+		}
+		return nil, fmt.Errorf("redis 命令 %s 失败: %w", args[0], err)
+	}
+	return reply, nil
+}
+
+// redisError Redis 返回的错误响应（"-ERR ..."），连接本身仍然可用
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// encodeRESPCommand 把命令编码成 RESP 数组: *<参数个数>\r\n$<长度>\r\n<参数>\r\n...
+func encodeRESPCommand(args []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(b.String())
+}
+
+// readRESP 读取一个 RESP 响应
+// 返回值类型: string（简单字符串/批量字符串）、int64（整数）、[]interface{}（数组）、nil（空值）
+func readRESP(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis 响应为空")
+	}
+
+	body := line[1:]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis 响应格式不对: %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2) // 数据 + \r\n
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis 响应格式不对: %q", line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			if values[i], err = readRESP(reader); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis 响应格式不对: %q", line)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRESP(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+	}{
+		{"简单字符串", "+OK\r\n", "OK"},
+		{"整数", ":42\r\n", int64(42)},
+		{"负整数", ":-3\r\n", int64(-3)},
+		{"批量字符串", "$5\r\nhello\r\n", "hello"},
+		{"包含换行的批量字符串", "$7\r\nhel\r\nlo\r\n", "hel\r\nlo"},
+		{"空批量字符串", "$0\r\n\r\n", ""},
+		{"空值", "$-1\r\n", nil},
+		{"空数组", "*-1\r\n", nil},
+		{"数组", "*2\r\n:1\r\n:250\r\n", []interface{}{int64(1), int64(250)}},
+		{"嵌套数组", "*3\r\n$1\r\na\r\n*1\r\n+OK\r\n$-1\r\n", []interface{}{"a", []interface{}{"OK"}, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.input))
+			got, err := readRESP(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readRESP(%q) = %#v，期望 %#v", tt.input, got, tt.want)
+			}
+			if rest := reader.Buffered(); rest != 0 {
+				t.Errorf("读完之后还剩 %d 个字节没消费", rest)
+			}
+		})
+	}
+}
+
+func TestReadRESPErrors(t *testing.T) {
+	t.Run("错误响应", func(t *testing.T) {
+		_, err := readRESP(bufio.NewReader(strings.NewReader("-ERR unknown command\r\n")))
+		var replyErr redisError
+		if !errors.As(err, &replyErr) || string(replyErr) != "ERR unknown command" {
+			t.Errorf("错误 = %v，期望 redisError(\"ERR unknown command\")", err)
+		}
+	})
+
+	for _, input := range []string{"", "\r\n", "?what\r\n", ":abc\r\n", "$abc\r\n", "$5\r\nhe", "*2\r\n:1\r\n"} {
+		_, err := readRESP(bufio.NewReader(strings.NewReader(input)))
+		var replyErr redisError
+		if err == nil || errors.As(err, &replyErr) {
+			t.Errorf("readRESP(%q) 的错误 = %v，期望协议错误", input, err)
+		}
+	}
+}
+
+func TestEncodeRESPCommand(t *testing.T) {
+	got := string(encodeRESPCommand([]string{"EVAL", "return 1", "0"}))
+	want := "*3\r\n$4\r\nEVAL\r\n$8\r\nreturn 1\r\n$1\r\n0\r\n"
+	if got != want {
+		t.Errorf("encodeRESPCommand = %q，期望 %q", got, want)
+	}
+
+	// 编码出来的命令按 RESP 读回来应该一模一样
+	values, err := readRESP(bufio.NewReader(strings.NewReader(got)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"EVAL", "return 1", "0"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("读回 %#v，期望 %#v", values, want)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+🚦 并发限制器 (加权信号量)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+TokenBucket 限制的是 "每秒多少个请求"，
+但有些 API 限制的是 "同时最多多少个请求在处理中"（并发数）。
+比如：每秒可以发 100 个请求，但同一时刻最多 10 个在途。
+
+信号量 (Semaphore) 就是干这个的：
+- Acquire(n): 占用 n 个名额，名额不够就排队
+- Release(n): 用完归还 n 个名额
+
+"加权" 是指一次可以占多个名额：导出大报表占 5 个，查一条记录占 1 个。
+
+⚠️ 公平性问题:
+如果名额只剩 2 个，一个要 5 个名额的大请求在排队，
+后面不断有要 1 个名额的小请求"插队"成功，大请求就会被饿死。
+所以这里严格按 FIFO 顺序分配：队首拿不到，后面的也不许插队。
+*/
+
+// semaphoreWaiter 一个排队中的 Acquire 调用
+type semaphoreWaiter struct {
+	n     int
+	ready chan struct{} // 分配到名额时关闭
+}
+
+// Semaphore 加权信号量（FIFO 公平）
+type Semaphore struct {
+	size int // 总名额
+
+	mu      sync.Mutex
+	cur     int        // 已占用的名额
+	waiters *list.List // 排队中的 *semaphoreWaiter
+}
+
+// NewSemaphore 创建信号量
+// size: 最多允许同时占用多少名额
+func NewSemaphore(size int) *Semaphore {
+	return &Semaphore{
+		size:    size,
+		waiters: list.New(),
+	}
+}
+
+// Acquire 占用 n 个名额，名额不够就排队等待
+// ctx 取消时返回 ctx.Err()，并且不占用任何名额
+func (s *Semaphore) Acquire(ctx context.Context, n int) error {
+	s.mu.Lock()
+	if n > s.size {
+		s.mu.Unlock()
+		return fmt.Errorf("一次占用 %d 个名额，超过了信号量总数 %d", n, s.size)
+	}
+	// 没人排队且名额够用，直接拿走
+	if s.waiters.Len() == 0 && s.size-s.cur >= n {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	waiter := &semaphoreWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(waiter)
+	s.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-waiter.ready:
+			// 取消的同时已经分配到名额了：归还名额，按取消处理
+			s.cur -= n
+			s.notifyWaiters()
+		default:
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			// 队首放弃了，后面的请求可能已经能拿到名额
+			if isFront {
+				s.notifyWaiters()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire 尝试占用 n 个名额（非阻塞）
+// 有人在排队时也返回 false，不允许插队
+func (s *Semaphore) TryAcquire(n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.waiters.Len() == 0 && s.size-s.cur >= n {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release 归还 n 个名额
+func (s *Semaphore) Release(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cur -= n
+	if s.cur < 0 {
+		panic("semaphore: 归还的名额比占用的多")
+	}
+	s.notifyWaiters()
+}
+
+// InUse 返回当前已占用的名额
+func (s *Semaphore) InUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur
+}
+
+// notifyWaiters 按 FIFO 顺序唤醒能拿到名额的等待者（调用方需持有锁）
+func (s *Semaphore) notifyWaiters() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		waiter := front.Value.(*semaphoreWaiter)
+		if s.size-s.cur < waiter.n {
+			// 队首拿不到名额，后面的也不许插队，防止大请求被饿死
+			return
+		}
+		s.cur += waiter.n
+		s.waiters.Remove(front)
+		close(waiter.ready)
+	}
+}
+
+// ============================================
+// 组合: 同时限制速率和并发数
+// ============================================
+
+// CombinedLimiter 同时受 TokenBucket（每秒请求数）和 Semaphore（并发数）约束
+type CombinedLimiter struct {
+	Rate        *TokenBucket
+	Concurrency *Semaphore
+}
+
+// Acquire 等待直到两个限制都满足，返回用来归还并发名额的 release 函数
+// 先占并发名额再拿令牌：如果先拿令牌，令牌可能在排队等名额期间白白"过期"，
+// 名额一释放就会有一批请求同时发出，破坏了速率限制的平滑效果
+func (cl *CombinedLimiter) Acquire(ctx context.Context, weight int) (release func(), err error) {
+	if err := cl.Concurrency.Acquire(ctx, weight); err != nil {
+		return nil, err
+	}
+	if err := cl.Rate.WaitN(ctx, 1); err != nil {
+		cl.Concurrency.Release(weight)
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { cl.Concurrency.Release(weight) })
+	}, nil
+}
+
+// ============================================
+// 演示: 每秒 10 个请求 + 最多 3 个在途
+// ============================================
+
+func combinedLimiterDemo() {
+	fmt.Println("📍 组合限流演示: 每秒 10 个请求，同时最多 3 个在途")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	limiter := &CombinedLimiter{
+		Rate:        NewTokenBucket(10, 3),
+		Concurrency: NewSemaphore(3),
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			release, err := limiter.Acquire(context.Background(), 1)
+			if err != nil {
+				fmt.Printf("  ❌ [请求 %d] %v\n", id, err)
+				return
+			}
+			defer release()
+
+			fmt.Printf("  ✅ [请求 %d] 开始 (时间: %s, 在途: %d)\n",
+				id, time.Now().Format("15:04:05.000"), limiter.Concurrency.InUse())
+			time.Sleep(300 * time.Millisecond) // 模拟慢接口
+		}(i)
+	}
+	wg.Wait()
+
+	fmt.Println("💡 虽然速率允许每 100ms 发一个，但在途数被限制在 3 个以内")
+}
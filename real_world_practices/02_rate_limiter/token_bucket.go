@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-learning-demo/real_world_practices/internal/bucket"
+)
+
+/*
+🪣 令牌桶（完整版）
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+main.go 里的 RateLimiter 是练习：用 buffered channel 当令牌桶，TODO(human) 留给你自己实现。
+中间件、按 key 限流以及后面的各种扩展需要一个现成能用的令牌桶，单独放在这个文件里。
+
+channel 的容量在创建后无法修改，也没法在运行时调整发放间隔，
+所以这里用的是思考题里提到的 "数值 + Mutex" 实现：
+不再由后台 goroutine 定时放令牌，而是在每次取令牌时，
+根据距离上次结算过去了多久，一次性补上这段时间应该发放的令牌（惰性结算）。
+
+结算的算法在 real_world_practices/internal/bucket，01_concurrent_downloader 的带宽上限也用它。
+*/
+
+// TokenBucket 可以在运行时调整速率和容量的令牌桶
+type TokenBucket struct {
+	mu    sync.Mutex
+	state bucket.State // 令牌数、发放间隔、容量和上次结算时间
+
+	changed chan struct{} // 速率或容量变化时关闭，唤醒正在 Wait 的调用方重新计算
+
+	metrics *LimiterMetrics    // 可选：统计指标（见 metrics.go）
+	trace   func(LimiterEvent) // 可选：每次判断都会回调
+}
+
+// NewTokenBucket 创建令牌桶
+// requestsPerSecond: 每秒允许多少请求
+// burstSize: 突发容量（允许短时间内有多少突发请求）
+func NewTokenBucket(requestsPerSecond int, burstSize int) *TokenBucket {
+	return &TokenBucket{
+		// 先填满桶（允许程序启动时立即有一些请求）
+		state:   bucket.New(time.Second/time.Duration(requestsPerSecond), burstSize, time.Now()),
+		changed: make(chan struct{}),
+	}
+}
+
+// Allow 尝试获取一个令牌（非阻塞）
+// 返回 true 表示获取成功，可以执行请求
+// 返回 false 表示没有令牌，应该拒绝请求
+func (tb *TokenBucket) Allow() bool {
+	return tb.AllowN(1)
+}
+
+// AllowN 尝试一次获取 n 个令牌（非阻塞），令牌不够时一个也不拿
+func (tb *TokenBucket) AllowN(n int) bool {
+	tb.mu.Lock()
+	now := time.Now()
+	tb.state.Refill(now)
+	event := LimiterEvent{Time: now, Op: "allow", N: n, Tokens: tb.state.Tokens, Capacity: tb.state.Capacity}
+	if tb.state.Tokens >= float64(n) {
+		tb.state.Tokens -= float64(n)
+		event.Allowed = true
+	}
+	tb.mu.Unlock()
+
+	tb.observe(event)
+	return event.Allowed
+}
+
+// takeUpTo 尽量多拿令牌，最多 n 个，返回实际拿到的数量
+func (tb *TokenBucket) takeUpTo(n int) int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.state.Refill(time.Now())
+	taken := int(tb.state.Tokens)
+	if taken > n {
+		taken = n
+	}
+	tb.state.Tokens -= float64(taken)
+	return taken
+}
+
+// tokensLocked 结算到 now 并返回桶里的令牌数（调用方需持有锁）
+// 和 takeLocked 配合，可以在同时锁住多个限流器的情况下先检查、再统一扣令牌
+func (tb *TokenBucket) tokensLocked(now time.Time) float64 {
+	tb.state.Refill(now)
+	return tb.state.Tokens
+}
+
+// takeLocked 扣掉 n 个令牌（调用方需持有锁，并且已经用 tokensLocked 确认令牌足够）
+func (tb *TokenBucket) takeLocked(n int) {
+	tb.state.Tokens -= float64(n)
+}
+
+// refund 归还之前拿走但没有用掉的令牌，桶满了就丢弃多出来的部分
+func (tb *TokenBucket) refund(n int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.state.Refill(time.Now())
+	tb.state.Tokens += float64(n)
+	if tb.state.Tokens > float64(tb.state.Capacity) {
+		tb.state.Tokens = float64(tb.state.Capacity)
+	}
+	tb.notifyChanged()
+}
+
+// Wait 等待获取一个令牌（阻塞，直到获取成功）
+func (tb *TokenBucket) Wait() {
+	_ = tb.WaitN(context.Background(), 1)
+}
+
+// WaitN 等待获取 n 个令牌，ctx 取消时返回 ctx.Err()
+// n 超过桶的容量时永远等不到，直接返回错误
+func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
+	start := time.Now()
+	event := LimiterEvent{Time: start, Op: "wait", N: n, Tokens: -1}
+	slept := false // 令牌不够、真的等待过
+
+	for {
+		tb.mu.Lock()
+		if n > tb.state.Capacity {
+			tb.state.Refill(time.Now())
+			event.Tokens, event.Capacity = tb.state.Tokens, tb.state.Capacity
+			tb.mu.Unlock()
+
+			// 记为一次拒绝，否则指标里看不到这类调用
+			event.Err = fmt.Errorf("一次请求 %d 个令牌，超过了桶的容量 %d", n, event.Capacity)
+			tb.observe(event)
+			return event.Err
+		}
+
+		tb.state.Refill(time.Now())
+		if event.Tokens < 0 {
+			// 只记录第一次判断时的令牌数，这才是调用方"到达"时桶的状态
+			event.Tokens = tb.state.Tokens
+			event.Capacity = tb.state.Capacity
+		}
+		if tb.state.Tokens >= float64(n) {
+			tb.state.Tokens -= float64(n)
+			tb.mu.Unlock()
+
+			event.Allowed = true
+			if slept {
+				event.Waited = time.Since(start)
+			}
+			tb.observe(event)
+			return nil
+		}
+		delay := tb.state.Delay(n)
+		changed := tb.changed
+		tb.mu.Unlock()
+
+		// 等到令牌攒够再重新尝试；如果中途调整了速率或容量，立即按新配置重新计算
+		slept = true
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			event.Waited = time.Since(start)
+			event.Err = ctx.Err()
+			tb.observe(event)
+			return ctx.Err()
+		}
+	}
+}
+
+// SetRate 运行时调整速率（每秒允许多少请求）
+// 调整之前攒下的令牌按旧速率结算，不会丢失也不会重复发放；
+// 正在 Wait 的调用方会被唤醒并按新速率重新计算等待时间
+// 速率必须大于 0，否则返回错误，限流器保持原来的速率
+func (tb *TokenBucket) SetRate(requestsPerSecond float64) error {
+	interval := time.Duration(float64(time.Second) / requestsPerSecond)
+	if !(requestsPerSecond > 0) || interval <= 0 {
+		// 0 和负数会算出负的间隔，NaN 比较永远为 false，太大的速率会让间隔变成 0
+		return fmt.Errorf("速率必须大于 0 且不超过每纳秒 1 个，当前为 %v", requestsPerSecond)
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.state.Refill(time.Now())
+	tb.state.Interval = interval
+	tb.notifyChanged()
+	return nil
+}
+
+// SetBurst 运行时调整突发容量
+// 容量变小时，超出新容量的令牌会被丢弃（和桶满时丢弃令牌是一个道理）
+// 容量至少为 1，否则 Wait 永远拿不到令牌；不合法时返回错误，限流器保持原来的容量
+func (tb *TokenBucket) SetBurst(burstSize int) error {
+	if burstSize < 1 {
+		return fmt.Errorf("突发容量至少为 1，当前为 %d", burstSize)
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.state.Refill(time.Now())
+	tb.state.Capacity = burstSize
+	if tb.state.Tokens > float64(burstSize) {
+		tb.state.Tokens = float64(burstSize)
+	}
+	tb.notifyChanged()
+	return nil
+}
+
+// Rate 返回当前速率（每秒允许多少请求）
+func (tb *TokenBucket) Rate() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return float64(time.Second) / float64(tb.state.Interval)
+}
+
+// Limit 返回桶的容量
+func (tb *TokenBucket) Limit() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.state.Capacity
+}
+
+// Remaining 返回桶里当前剩余的令牌数
+func (tb *TokenBucket) Remaining() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.state.Refill(time.Now())
+	return int(tb.state.Tokens)
+}
+
+// Delay 返回还要等多久桶里才会有 n 个令牌（已经够了返回 0）
+func (tb *TokenBucket) Delay(n int) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.state.Refill(time.Now())
+	return tb.state.Delay(n)
+}
+
+// SetMetrics 设置统计指标，传 nil 关闭统计
+func (tb *TokenBucket) SetMetrics(metrics *LimiterMetrics) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.metrics = metrics
+}
+
+// SetTrace 设置追踪回调，每次 Allow / Wait 判断后都会调用，传 nil 关闭
+// 回调在锁外执行，可以在里面调用限流器的其他方法
+func (tb *TokenBucket) SetTrace(trace func(LimiterEvent)) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.trace = trace
+}
+
+// Stop 停止限流器
+// 惰性结算不需要后台 goroutine，保留这个方法是为了兼容已有的调用方
+func (tb *TokenBucket) Stop() {}
+
+// observe 把一次判断交给指标和追踪回调（不能持有锁调用）
+func (tb *TokenBucket) observe(event LimiterEvent) {
+	tb.mu.Lock()
+	metrics, trace := tb.metrics, tb.trace
+	tb.mu.Unlock()
+
+	if metrics != nil {
+		metrics.Record(event)
+	}
+	if trace != nil {
+		trace(event)
+	}
+}
+
+// notifyChanged 唤醒所有正在等待的调用方（调用方需持有锁）
+func (tb *TokenBucket) notifyChanged() {
+	close(tb.changed)
+	tb.changed = make(chan struct{})
+}
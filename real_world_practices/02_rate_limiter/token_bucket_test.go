@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSetRateRejectsInvalidRates(t *testing.T) {
+	limiter := NewTokenBucket(10, 1)
+
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1), 1e10} {
+		if err := limiter.SetRate(rate); err == nil {
+			t.Errorf("SetRate(%v) 应该返回错误", rate)
+		}
+		if got := limiter.Rate(); math.Abs(got-10) > 1e-9 {
+			t.Fatalf("SetRate(%v) 失败后速率 = %v，期望保持 10", rate, got)
+		}
+	}
+
+	if err := limiter.SetRate(20); err != nil {
+		t.Fatalf("SetRate(20): %v", err)
+	}
+	if got := limiter.Rate(); math.Abs(got-20) > 1e-9 {
+		t.Errorf("速率 = %v，期望 20", got)
+	}
+}
+
+func TestWaitNStillPacesAfterRejectedSetRate(t *testing.T) {
+	limiter := NewTokenBucket(10, 1)
+	limiter.SetRate(0) // 被拒绝，仍然是每秒 10 个
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.WaitN(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第一个令牌是现成的，后两个各等 100ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("3 个令牌只用了 %v，限流器没有限速", elapsed)
+	}
+}
+
+func TestSetBurstRejectsBurstBelowOne(t *testing.T) {
+	limiter := NewTokenBucket(10, 3)
+
+	for _, burst := range []int{0, -1} {
+		if err := limiter.SetBurst(burst); err == nil {
+			t.Errorf("SetBurst(%d) 应该返回错误", burst)
+		}
+		if got := limiter.Limit(); got != 3 {
+			t.Fatalf("SetBurst(%d) 失败后容量 = %d，期望保持 3", burst, got)
+		}
+	}
+
+	// 被拒绝之后 Wait 仍然要真的拿令牌：3 个现成的，后两个各等 100ms
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		limiter.Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("5 次 Wait 只用了 %v，没有拿令牌", elapsed)
+	}
+}
+
+func TestSetBurstDiscardsTokensAboveNewCapacity(t *testing.T) {
+	limiter := NewTokenBucket(1, 10)
+
+	if err := limiter.SetBurst(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.Remaining(); got != 2 {
+		t.Errorf("容量缩到 2 后剩余 %d 个令牌，期望 2", got)
+	}
+
+	// 容量变大不会凭空多出令牌
+	if err := limiter.SetBurst(10); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.Remaining(); got != 2 {
+		t.Errorf("容量扩到 10 后剩余 %d 个令牌，期望仍然是 2", got)
+	}
+}
+
+func TestWaitNWakesUpOnConfigChange(t *testing.T) {
+	t.Run("提高速率", func(t *testing.T) {
+		limiter := NewTokenBucket(1, 1)
+		limiter.Allow() // 拿走唯一的令牌，下一个要等 1 秒
+
+		done := make(chan error, 1)
+		go func() { done <- limiter.WaitN(context.Background(), 1) }()
+		time.Sleep(20 * time.Millisecond) // 让它先按旧速率睡下
+
+		start := time.Now()
+		if err := limiter.SetRate(1000); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+				t.Errorf("提速后 %v 才拿到令牌", elapsed)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("提速后等待者没有被唤醒，还在按旧速率睡")
+		}
+	})
+
+	t.Run("容量缩到比请求的少", func(t *testing.T) {
+		limiter := NewTokenBucket(1, 5)
+		limiter.AllowN(5)
+
+		done := make(chan error, 1)
+		go func() { done <- limiter.WaitN(context.Background(), 5) }()
+		time.Sleep(20 * time.Millisecond)
+
+		if err := limiter.SetBurst(2); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("容量只剩 2，WaitN(5) 应该返回错误而不是成功")
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("容量缩小后 WaitN(5) 永远等不到，应该立即返回错误")
+		}
+	})
+}
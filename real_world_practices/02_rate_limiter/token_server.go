@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+🖥️ 迷你令牌服务器
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+一个基于 TCP 的文本协议，每行一条命令：
+
+  LEASE <key> <n>     申请最多 n 个令牌
+  → OK <领到的数量> <租约毫秒数> <建议重试毫秒数>
+
+  RELEASE <key> <n>   归还 n 个没用完的令牌
+  → OK <实际接受的数量>
+
+  出错时返回 → ERR <原因>
+
+服务器为每个 key 维护一个 TokenBucket（全局配额就在这里），
+并记录每个连接持有的、还没过期的租约：
+- RELEASE 最多只接受该连接还持有的数量，防止客户端"凭空"还令牌
+- 连接断开（进程退出或崩溃）时，它的租约记录直接丢弃，按已用掉处理
+*/
+
+// serverLease 服务器记录的一条租约
+type serverLease struct {
+	remaining int // 还能被归还的令牌数
+	expiresAt time.Time
+}
+
+// TokenServer 令牌服务器
+type TokenServer struct {
+	limiters *KeyedLimiter
+	leaseTTL time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewTokenServer 创建令牌服务器
+// requestsPerSecond / burstSize: 每个 key 的全局配额
+// leaseTTL: 租约有效期，越短进程崩溃时浪费的令牌越少，但领取越频繁
+func NewTokenServer(requestsPerSecond int, burstSize int, leaseTTL time.Duration) *TokenServer {
+	return &TokenServer{
+		limiters: NewKeyedLimiter(requestsPerSecond, burstSize),
+		leaseTTL: leaseTTL,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Start 监听 addr 并在后台处理连接，返回实际监听的地址（addr 端口为 0 时很有用）
+func (s *TokenServer) Start(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("令牌服务器监听 %s 失败: %w", addr, err)
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.acceptLoop(listener)
+
+	return listener.Addr().String(), nil
+}
+
+// Close 关闭服务器和所有连接
+func (s *TokenServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.limiters.Stop()
+	return err
+}
+
+// acceptLoop 接收新连接，每个连接一个 goroutine
+func (s *TokenServer) acceptLoop(listener net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return // listener 被关闭
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn 处理一个连接上的所有命令
+func (s *TokenServer) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	// 这个连接持有的租约，连接断开时随之丢弃
+	leases := make(map[string][]serverLease)
+
+	scanner := bufio.NewScanner(conn)
+	writer := bufio.NewWriter(conn)
+	for scanner.Scan() {
+		reply := s.handleCommand(scanner.Text(), leases)
+		writer.WriteString(reply + "\n")
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handleCommand 执行一条命令，返回响应行
+func (s *TokenServer) handleCommand(line string, leases map[string][]serverLease) string {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return "ERR 命令格式: LEASE|RELEASE <key> <n>"
+	}
+	key := fields[1]
+	n, err := strconv.Atoi(fields[2])
+	if err != nil || n <= 0 {
+		return "ERR n 必须是正整数"
+	}
+
+	now := time.Now()
+	leases[key] = pruneLeases(leases[key], now)
+	limiter := s.limiters.Get(key)
+
+	switch strings.ToUpper(fields[0]) {
+	case "LEASE":
+		granted := limiter.takeUpTo(n)
+		if granted > 0 {
+			leases[key] = append(leases[key], serverLease{remaining: granted, expiresAt: now.Add(s.leaseTTL)})
+		}
+		return fmt.Sprintf("OK %d %d %d", granted, s.leaseTTL.Milliseconds(), limiter.Delay(1).Milliseconds())
+
+	case "RELEASE":
+		accepted := 0
+		held := leases[key]
+		// 优先归还最新的租约，它们离过期最远
+		for i := len(held) - 1; i >= 0 && accepted < n; i-- {
+			take := held[i].remaining
+			if take > n-accepted {
+				take = n - accepted
+			}
+			held[i].remaining -= take
+			accepted += take
+		}
+		leases[key] = pruneLeases(held, now)
+		if accepted > 0 {
+			limiter.refund(accepted)
+		}
+		return fmt.Sprintf("OK %d", accepted)
+
+	default:
+		return "ERR 未知命令 " + fields[0]
+	}
+}
+
+// pruneLeases 去掉已过期或已全部归还的租约
+func pruneLeases(leases []serverLease, now time.Time) []serverLease {
+	kept := leases[:0]
+	for _, lease := range leases {
+		if lease.remaining > 0 && now.Before(lease.expiresAt) {
+			kept = append(kept, lease)
+		}
+	}
+	return kept
+}
+
+// ============================================
+// 客户端
+// ============================================
+
+// TokenClient 令牌服务器的客户端，实现了 TokenAuthority
+// 一个客户端一条连接，命令串行发送；连接出错时下次调用自动重连
+type TokenClient struct {
+	addr string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewTokenClient 创建客户端（第一次调用时才建立连接）
+func NewTokenClient(addr string) *TokenClient {
+	return &TokenClient{addr: addr}
+}
+
+// Lease 申请最多 n 个令牌
+func (c *TokenClient) Lease(ctx context.Context, key string, n int) (Lease, error) {
+	start := time.Now()
+	fields, err := c.call(ctx, fmt.Sprintf("LEASE %s %d", key, n), 4)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	granted, _ := strconv.Atoi(fields[1])
+	ttl, _ := strconv.Atoi(fields[2])
+	retry, _ := strconv.Atoi(fields[3])
+	return Lease{
+		Granted: granted,
+		// 从发出请求的时刻算起，比服务器记录的过期时间早一点，保证不会用到服务器认为已过期的令牌
+		ExpiresAt:  start.Add(time.Duration(ttl) * time.Millisecond),
+		RetryAfter: time.Duration(retry) * time.Millisecond,
+	}, nil
+}
+
+// Release 归还 n 个令牌
+func (c *TokenClient) Release(ctx context.Context, key string, n int) error {
+	_, err := c.call(ctx, fmt.Sprintf("RELEASE %s %d", key, n), 2)
+	return err
+}
+
+// Close 关闭连接
+func (c *TokenClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// call 发送一条命令并读取响应，响应必须是 "OK" 开头、共 fieldCount 个字段
+func (c *TokenClient) call(ctx context.Context, command string, fieldCount int) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+		if err != nil {
+			return nil, fmt.Errorf("连接令牌服务器失败: %w", err)
+		}
+		c.conn = conn
+		c.reader = bufio.NewReader(conn)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	c.conn.SetDeadline(deadline)
+
+	line, err := c.roundTrip(command)
+	if err != nil {
+		// 连接状态未知（可能读到一半），直接丢掉，下次重连
+		c.conn.Close()
+		c.conn = nil
+		return nil, fmt.Errorf("令牌服务器通信失败: %w", err)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "OK" {
+		return nil, errors.New("令牌服务器返回错误: " + line)
+	}
+	if len(fields) != fieldCount {
+		return nil, fmt.Errorf("令牌服务器响应格式不对: %q", line)
+	}
+	return fields, nil
+}
+
+// roundTrip 写一行命令，读一行响应
+func (c *TokenClient) roundTrip(command string) (string, error) {
+	if _, err := c.conn.Write([]byte(command + "\n")); err != nil {
+		return "", err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
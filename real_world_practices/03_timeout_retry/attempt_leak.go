@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+/*
+🕳️ 被丢下的尝试: goroutine 泄漏
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+最初的重试草稿是这样写的:
+
+	go func() { result, err := operation(); resultCh <- ... }()
+	select {
+	case result := <-resultCh:
+	case <-time.After(5 * time.Second): // 超时了，开始下一次尝试
+	}
+
+超时之后 select 走了，可 goroutine 里的 operation() 还在跑：
+- 它还占着连接、内存，下游还在处理这个请求
+- 下一次尝试马上又发出去，同一时刻就有两个、三个请求在跑
+- 每超时一次，就多一个被丢下的 goroutine
+
+现在的 Retry:
+1. 每次尝试拿到的 ctx 在超时后会被取消，operation 收到信号就该返回
+2. operation 在当前 goroutine 里同步执行，返回之后才开始下一次尝试
+   → 同一时刻最多一次尝试在执行（需要并发尝试时请显式使用对冲请求）
+*/
+
+// abandoningRetry 最初草稿的写法（反面教材）：超时后丢下还在执行的尝试
+func abandoningRetry(maxAttempts int, attemptTimeout time.Duration, operation func() error) error {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- operation()
+		}()
+
+		select {
+		case err := <-errCh:
+			if err == nil {
+				return nil
+			}
+		case <-time.After(attemptTimeout):
+			// 超时，直接开始下一次 —— 上面的 goroutine 还在跑
+		}
+	}
+	return fmt.Errorf("达到最大重试次数 (%d)", maxAttempts)
+}
+
+// settledGoroutines 等待 goroutine 数稳定下来再返回（刚结束的 goroutine 需要一点时间退出）
+func settledGoroutines(baseline int) int {
+	n := runtime.NumGoroutine()
+	for i := 0; i < 50 && n > baseline; i++ {
+		time.Sleep(10 * time.Millisecond)
+		n = runtime.NumGoroutine()
+	}
+	return n
+}
+
+// ============================================
+// 演示: 用 goroutine 数证明没有泄漏
+// ============================================
+
+func attemptLeakDemo() {
+	fmt.Println("📍 泄漏检查: 一个总是很慢的服务，单次超时 20ms，每个请求尝试 3 次，共 10 个请求")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	var inFlight, maxInFlight int64
+	track := func() func() {
+		n := atomic.AddInt64(&inFlight, 1)
+		for {
+			peak := atomic.LoadInt64(&maxInFlight)
+			if n <= peak || atomic.CompareAndSwapInt64(&maxInFlight, peak, n) {
+				break
+			}
+		}
+		return func() { atomic.AddInt64(&inFlight, -1) }
+	}
+
+	// 反面教材：operation 不知道自己已经超时，会一直跑完 1 秒
+	baseline := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		abandoningRetry(3, 20*time.Millisecond, func() error {
+			defer track()()
+			time.Sleep(time.Second)
+			return nil
+		})
+	}
+	fmt.Printf("  ❌ 草稿写法: 结束后多出 %d 个 goroutine，最多同时 %d 个尝试在执行\n",
+		runtime.NumGoroutine()-baseline, atomic.LoadInt64(&maxInFlight))
+	time.Sleep(time.Second) // 等它们自己跑完，别影响下面的统计
+
+	// Retry：超时后 ctx 被取消，operation 立即返回
+	atomic.StoreInt64(&maxInFlight, 0)
+	baseline = runtime.NumGoroutine()
+	config := RetryConfig{
+		MaxRetries:     3,
+		InitialBackoff: 5 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		Timeout:        time.Second,
+		AttemptTimeout: 20 * time.Millisecond,
+	}
+	for i := 0; i < 10; i++ {
+		Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+			defer track()()
+			timer := time.NewTimer(time.Second)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return "ok", nil
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		})
+	}
+	leaked := settledGoroutines(baseline) - baseline
+	fmt.Printf("  ✅ Retry:    结束后多出 %d 个 goroutine，最多同时 %d 个尝试在执行\n",
+		leaked, atomic.LoadInt64(&maxInFlight))
+}
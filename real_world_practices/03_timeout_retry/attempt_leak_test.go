@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inFlightTracker 统计同一时刻最多有几次尝试在执行
+type inFlightTracker struct {
+	current, peak int64
+}
+
+// enter 记录一次尝试开始，返回的函数在尝试结束时调用
+func (tr *inFlightTracker) enter() func() {
+	n := atomic.AddInt64(&tr.current, 1)
+	for {
+		peak := atomic.LoadInt64(&tr.peak)
+		if n <= peak || atomic.CompareAndSwapInt64(&tr.peak, peak, n) {
+			break
+		}
+	}
+	return func() { atomic.AddInt64(&tr.current, -1) }
+}
+
+// slowOperation 总是要 1 秒才返回，ctx 取消时立即返回
+func slowOperation(tr *inFlightTracker) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		defer tr.enter()()
+		timer := time.NewTimer(time.Second)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return "ok", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func TestRetryTimeoutLeavesNoGoroutines(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	config := RetryConfig{
+		MaxRetries:     10,
+		InitialBackoff: 5 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Timeout:        100 * time.Millisecond,
+		AttemptTimeout: 20 * time.Millisecond,
+	}
+	var tr inFlightTracker
+	for i := 0; i < 10; i++ {
+		_, err := Retry(context.Background(), config, slowOperation(&tr))
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrAttemptTimeout) {
+			t.Fatalf("Retry = %v，期望超时", err)
+		}
+	}
+
+	if got := settledGoroutines(baseline); got != baseline {
+		t.Errorf("Retry 超时后 goroutine 数 = %d，期望回到 %d", got, baseline)
+	}
+}
+
+func TestRetryRunsOneAttemptAtATime(t *testing.T) {
+	config := RetryConfig{
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Timeout:        time.Second,
+		AttemptTimeout: 20 * time.Millisecond,
+	}
+	var tr inFlightTracker
+	for i := 0; i < 10; i++ {
+		Retry(context.Background(), config, slowOperation(&tr))
+	}
+
+	if peak := atomic.LoadInt64(&tr.peak); peak != 1 {
+		t.Errorf("同一时刻最多有 %d 次尝试在执行，期望 1", peak)
+	}
+}
+
+// 反面教材确实会重叠、会留下 goroutine，说明上面两个检查是有效的
+func TestAbandoningRetryOverlapsAttempts(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	var tr inFlightTracker
+	abandoningRetry(3, 10*time.Millisecond, func() error {
+		defer tr.enter()()
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+
+	if leaked := runtime.NumGoroutine() - baseline; leaked < 1 {
+		t.Errorf("草稿写法返回后多出 %d 个 goroutine，期望至少 1 个", leaked)
+	}
+	if peak := atomic.LoadInt64(&tr.peak); peak < 2 {
+		t.Errorf("草稿写法同一时刻最多 %d 次尝试，期望至少 2", peak)
+	}
+	settledGoroutines(baseline) // 等被丢下的尝试跑完，别影响其他测试
+}
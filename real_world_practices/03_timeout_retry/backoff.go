@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+/*
+🎲 退避策略与抖动 (Jitter)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+思考题 3 的答案：
+1000 个客户端在同一时刻失败，用同样的指数退避，就会在 100ms、200ms、400ms...
+同一时刻一起重试 —— 服务刚缓过来，又被同一波流量打趴下。
+解决办法是在等待时间里加随机数（抖动），把重试打散到一段时间里。
+
+常见的几种策略（base = InitialBackoff, cap = MaxBackoff）:
+- Constant:     每次都等 base
+- Linear:       base, 2*base, 3*base ...
+- Exponential:  base, 2*base, 4*base ...（不加抖动，原来的行为）
+- FullJitter:   random(0, 指数值)              ← 打散效果最好，总等待最短
+- EqualJitter:  指数值/2 + random(0, 指数值/2)  ← 保证至少等一半
+- Decorrelated: random(base, 上次等待*3)        ← 不依赖重试次数，只看上一次
+
+所有策略的结果都不超过 cap；cap 为 0 表示不设上限（但不会溢出，最多到 time.Duration 的最大值）。
+
+💡 测试时给 RetryConfig.Rand 传一个固定种子的随机源，抖动就可以复现了。
+*/
+
+// BackoffStrategy 退避策略
+type BackoffStrategy int
+
+const (
+	BackoffExponential  BackoffStrategy = iota // 指数退避，不加抖动（零值，兼容原来的行为）
+	BackoffConstant                            // 固定间隔
+	BackoffLinear                              // 线性增长
+	BackoffFullJitter                          // 指数退避 + 全抖动
+	BackoffEqualJitter                         // 指数退避 + 一半抖动
+	BackoffDecorrelated                        // 去相关抖动
+)
+
+// String 返回策略名
+func (s BackoffStrategy) String() string {
+	switch s {
+	case BackoffExponential:
+		return "exponential"
+	case BackoffConstant:
+		return "constant"
+	case BackoffLinear:
+		return "linear"
+	case BackoffFullJitter:
+		return "full-jitter"
+	case BackoffEqualJitter:
+		return "equal-jitter"
+	case BackoffDecorrelated:
+		return "decorrelated-jitter"
+	default:
+		return fmt.Sprintf("BackoffStrategy(%d)", int(s))
+	}
+}
+
+// Backoff 计算每次重试前要等多久
+// 去相关抖动需要记住上一次的等待时间，所以每次重试流程都要用一个新的 Backoff
+type Backoff struct {
+	strategy BackoffStrategy
+	initial  time.Duration
+	max      time.Duration
+	rand     *rand.Rand // nil 时使用全局随机源
+
+	retries int           // 已经退避过几次
+	prev    time.Duration // 上一次的等待时间（去相关抖动用）
+}
+
+// NewBackoff 根据配置创建退避计算器
+func NewBackoff(config RetryConfig) *Backoff {
+	return &Backoff{
+		strategy: config.Strategy,
+		initial:  config.InitialBackoff,
+		max:      config.MaxBackoff,
+		rand:     config.Rand,
+	}
+}
+
+// Next 返回下一次重试前要等待的时间
+func (b *Backoff) Next() time.Duration {
+	b.retries++
+
+	var delay time.Duration
+	switch b.strategy {
+	case BackoffConstant:
+		delay = b.initial
+	case BackoffLinear:
+		delay = b.multiply(b.initial, b.retries)
+	case BackoffFullJitter:
+		delay = b.between(0, b.exponential())
+	case BackoffEqualJitter:
+		half := b.exponential() / 2
+		delay = half + b.between(0, half)
+	case BackoffDecorrelated:
+		prev := b.prev
+		if prev < b.initial {
+			prev = b.initial
+		}
+		delay = b.between(b.initial, b.multiply(prev, 3))
+	default:
+		delay = b.exponential()
+	}
+
+	if delay > b.limit() {
+		delay = b.limit()
+	}
+	b.prev = delay
+	return delay
+}
+
+// Reset 回到第一次重试的状态
+func (b *Backoff) Reset() {
+	b.retries = 0
+	b.prev = 0
+}
+
+// exponential 返回第 retries 次重试的指数退避值（不超过上限）
+func (b *Backoff) exponential() time.Duration {
+	delay := b.initial
+	for i := 1; i < b.retries; i++ {
+		delay = b.multiply(delay, 2)
+		if delay >= b.limit() {
+			return b.limit() // 提前返回，重试次数很多时不用继续翻倍
+		}
+	}
+	return delay
+}
+
+// limit 返回等待时间的上限，MaxBackoff 为 0 表示不设上限
+func (b *Backoff) limit() time.Duration {
+	if b.max > 0 {
+		return b.max
+	}
+	return math.MaxInt64
+}
+
+// multiply 返回 d*n，超过上限时返回上限，避免溢出变成负数
+func (b *Backoff) multiply(d time.Duration, n int) time.Duration {
+	if n > 0 && d > b.limit()/time.Duration(n) {
+		return b.limit()
+	}
+	return d * time.Duration(n)
+}
+
+// between 返回 [lo, hi] 之间的随机时间
+func (b *Backoff) between(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	int63n := rand.Int63n
+	if b.rand != nil {
+		int63n = b.rand.Int63n
+	}
+	span := int64(hi - lo)
+	if span == math.MaxInt64 {
+		return lo + time.Duration(int63n(span)) // span+1 会溢出，少一纳秒无所谓
+	}
+	return lo + time.Duration(int63n(span+1))
+}
+
+// ============================================
+// 演示: 各种策略的等待时间
+// ============================================
+
+func backoffStrategiesDemo() {
+	fmt.Println("📍 退避策略对比: base=100ms, cap=2s, 固定随机种子")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	strategies := []BackoffStrategy{
+		BackoffConstant, BackoffLinear, BackoffExponential,
+		BackoffFullJitter, BackoffEqualJitter, BackoffDecorrelated,
+	}
+	for _, strategy := range strategies {
+		backoff := NewBackoff(RetryConfig{
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     2 * time.Second,
+			Strategy:       strategy,
+			Rand:           rand.New(rand.NewSource(42)),
+		})
+
+		fmt.Printf("  %-20s", strategy)
+		for i := 0; i < 6; i++ {
+			fmt.Printf(" %6v", backoff.Next().Round(time.Millisecond))
+		}
+		fmt.Println()
+	}
+}
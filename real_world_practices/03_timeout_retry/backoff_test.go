@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBackoffStrategies(t *testing.T) {
+	const (
+		base     = 100 * time.Millisecond
+		maxDelay = time.Second
+	)
+	// 第 i 次重试（从 1 开始）允许的范围；prev 是上一次的等待时间（去相关抖动用）
+	type bounds func(i int, prev time.Duration) (lo, hi time.Duration)
+	exp := func(i int) time.Duration {
+		d := base << (i - 1)
+		if d > maxDelay {
+			d = maxDelay
+		}
+		return d
+	}
+
+	tests := []struct {
+		strategy BackoffStrategy
+		bounds   bounds
+	}{
+		{BackoffConstant, func(int, time.Duration) (time.Duration, time.Duration) { return base, base }},
+		{BackoffLinear, func(i int, _ time.Duration) (time.Duration, time.Duration) {
+			d := base * time.Duration(i)
+			if d > maxDelay {
+				d = maxDelay
+			}
+			return d, d
+		}},
+		{BackoffExponential, func(i int, _ time.Duration) (time.Duration, time.Duration) { return exp(i), exp(i) }},
+		{BackoffFullJitter, func(i int, _ time.Duration) (time.Duration, time.Duration) { return 0, exp(i) }},
+		{BackoffEqualJitter, func(i int, _ time.Duration) (time.Duration, time.Duration) { return exp(i) / 2, exp(i) }},
+		{BackoffDecorrelated, func(_ int, prev time.Duration) (time.Duration, time.Duration) {
+			if prev < base {
+				prev = base
+			}
+			hi := prev * 3
+			if hi > maxDelay {
+				hi = maxDelay
+			}
+			return base, hi
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy.String(), func(t *testing.T) {
+			backoff := NewBackoff(RetryConfig{
+				InitialBackoff: base,
+				MaxBackoff:     maxDelay,
+				Strategy:       tt.strategy,
+				Rand:           rand.New(rand.NewSource(42)),
+			})
+
+			var prev time.Duration
+			var delays []time.Duration
+			for i := 1; i <= 12; i++ {
+				got := backoff.Next()
+				lo, hi := tt.bounds(i, prev)
+				if got < lo || got > hi {
+					t.Errorf("第 %d 次 Next() = %v，期望在 [%v, %v] 之间", i, got, lo, hi)
+				}
+				if got > maxDelay {
+					t.Errorf("第 %d 次 Next() = %v，超过了 MaxBackoff %v", i, got, maxDelay)
+				}
+				prev = got
+				delays = append(delays, got)
+			}
+
+			// 相同的种子，结果完全相同
+			again := NewBackoff(RetryConfig{
+				InitialBackoff: base,
+				MaxBackoff:     maxDelay,
+				Strategy:       tt.strategy,
+				Rand:           rand.New(rand.NewSource(42)),
+			})
+			for i, want := range delays {
+				if got := again.Next(); got != want {
+					t.Fatalf("相同种子第 %d 次 Next() = %v，第一次是 %v", i+1, got, want)
+				}
+			}
+
+			// Reset 之后从第一次重新开始
+			backoff.Reset()
+			lo, hi := tt.bounds(1, 0)
+			if got := backoff.Next(); got < lo || got > hi {
+				t.Errorf("Reset 后 Next() = %v，期望在 [%v, %v] 之间", got, lo, hi)
+			}
+		})
+	}
+}
+
+func TestBackoffWithoutMaxDoesNotOverflow(t *testing.T) {
+	strategies := []BackoffStrategy{
+		BackoffConstant, BackoffLinear, BackoffExponential,
+		BackoffFullJitter, BackoffEqualJitter, BackoffDecorrelated,
+	}
+	for _, strategy := range strategies {
+		t.Run(strategy.String(), func(t *testing.T) {
+			backoff := NewBackoff(RetryConfig{
+				InitialBackoff: time.Second,
+				Strategy:       strategy,
+				Rand:           rand.New(rand.NewSource(1)),
+			})
+
+			// 翻倍 63 次以上就会溢出 int64
+			var last time.Duration
+			for i := 1; i <= 200; i++ {
+				got := backoff.Next()
+				if got < 0 {
+					t.Fatalf("第 %d 次 Next() = %v，溢出成了负数", i, got)
+				}
+				last = got
+			}
+			if strategy == BackoffExponential && last != math.MaxInt64 {
+				t.Errorf("不设上限时指数退避最终应该停在 time.Duration 的最大值，得到 %v", last)
+			}
+		})
+	}
+}
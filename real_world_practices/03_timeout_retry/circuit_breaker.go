@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+🔌 熔断器 (Circuit Breaker)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+思考题 2 的答案：服务彻底挂了的时候，每个客户端还在重试 3 次，
+流量直接翻 3 倍，服务想恢复都恢复不了 —— 这就是重试风暴引起的雪崩。
+
+熔断器像家里的保险丝，三种状态:
+
+	Closed（正常）──失败太多──▶ Open（断开）──等一会儿──▶ HalfOpen（试探）
+	   ▲                          ▲                           │
+	   └────────探测都成功──────────┼───────────────────────────┤
+	                              └────────探测失败─────────────┘
+
+- Closed:   请求正常通过，统计失败次数
+- Open:     直接返回 ErrCircuitOpen，不调用下游，给它喘息的时间
+- HalfOpen: 只放少量探测请求过去，成功了就恢复，失败了继续断开
+
+🔨 触发熔断的条件（满足任一个）:
+1. 连续失败 N 次
+2. 统计窗口内失败比例超过阈值（样本足够多时才判断，避免 1 次失败 = 100%）
+
+💡 4xx 这类永久错误是调用方的问题，不算下游故障，不计入失败。
+*/
+
+// ErrCircuitOpen 熔断器打开时拒绝请求
+var ErrCircuitOpen = errors.New("熔断器已打开")
+
+// errOperationPanicked Execute 里的 operation panic 时，按这个错误记一次失败
+var errOperationPanicked = errors.New("operation 发生了 panic")
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	StateClosed   BreakerState = iota // 正常
+	StateOpen                         // 断开
+	StateHalfOpen                     // 试探
+)
+
+// String 返回状态名
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	ConsecutiveFailures int           // 连续失败多少次熔断（0 表示不按连续失败判断）
+	FailureRatio        float64       // 窗口内失败比例达到多少熔断，比如 0.5（0 表示不按比例判断）
+	MinRequests         int           // 窗口内至少多少个请求才按比例判断
+	Window              time.Duration // Closed 状态的统计窗口，到期清零（0 表示不清零）
+	OpenTimeout         time.Duration // Open 多久之后进入 HalfOpen
+	HalfOpenProbes      int           // HalfOpen 时放行几个探测请求，全部成功才恢复（至少 1）
+
+	// IsFailure 判断一个错误算不算下游故障，nil 时永久错误和调用方取消不算
+	IsFailure func(err error) bool
+}
+
+// CircuitBreaker 熔断器
+type CircuitBreaker struct {
+	config BreakerConfig
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  uint64 // 每次切换状态加 1，旧状态下发出的请求结果不再计数
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	openedAt    time.Time
+	probes      int // HalfOpen 已放行的探测数
+	probeOK     int // HalfOpen 已成功的探测数
+
+	// OnStateChange 状态切换时回调（可选，在锁外调用，需在使用前设置）
+	OnStateChange func(from, to BreakerState)
+}
+
+// NewCircuitBreaker 创建熔断器
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.HalfOpenProbes < 1 {
+		config.HalfOpenProbes = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isDownstreamFailure
+	}
+	return &CircuitBreaker{
+		config:      config,
+		windowStart: time.Now(),
+	}
+}
+
+// isDownstreamFailure 默认的失败判断：永久错误是调用方的问题，主动取消也不是下游的错
+func isDownstreamFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	return DefaultClassifier(err) != ClassPermanent
+}
+
+// State 返回当前状态
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	state, transition := cb.currentLocked(time.Now())
+	cb.mu.Unlock()
+
+	cb.notify(transition)
+	return state
+}
+
+// Allow 申请执行一次请求
+// 放行时返回 done，调用方必须在请求结束后调用 done(err) 汇报结果；
+// 拒绝时返回 ErrCircuitOpen
+func (cb *CircuitBreaker) Allow() (done func(err error), err error) {
+	cb.mu.Lock()
+	state, transition := cb.currentLocked(time.Now())
+
+	switch state {
+	case StateOpen:
+		cb.mu.Unlock()
+		cb.notify(transition)
+		return nil, ErrCircuitOpen
+	case StateHalfOpen:
+		if cb.probes >= cb.config.HalfOpenProbes {
+			cb.mu.Unlock()
+			cb.notify(transition)
+			return nil, fmt.Errorf("%w（正在试探）", ErrCircuitOpen)
+		}
+		cb.probes++
+	}
+	generation := cb.generation
+	cb.mu.Unlock()
+	cb.notify(transition)
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { cb.record(generation, err) })
+	}, nil
+}
+
+// Execute 经过熔断器执行 operation
+// operation panic 时记一次失败再继续 panic，否则 HalfOpen 的探测名额永远结算不了，熔断器会一直拒绝
+func Execute[T any](ctx context.Context, cb *CircuitBreaker, operation func(ctx context.Context) (T, error)) (result T, err error) {
+	done, err := cb.Allow()
+	if err != nil {
+		return result, err
+	}
+
+	err = errOperationPanicked // operation 正常返回时会被覆盖
+	defer func() { done(err) }()
+
+	return operation(ctx)
+}
+
+// WithBreaker 给 operation 套上熔断器，可以直接交给 Retry:
+//
+//	Retry(ctx, config, WithBreaker(cb, operation))
+//
+// 每一次尝试都经过熔断器；熔断器打开时返回永久错误，Retry 立即放弃，不再给下游加压。
+func WithBreaker[T any](cb *CircuitBreaker, operation func(ctx context.Context) (T, error)) func(ctx context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		result, err := Execute(ctx, cb, operation)
+		if errors.Is(err, ErrCircuitOpen) {
+			return result, Permanent(err)
+		}
+		return result, err
+	}
+}
+
+// record 记录一次请求的结果
+func (cb *CircuitBreaker) record(generation uint64, err error) {
+	cb.mu.Lock()
+	now := time.Now()
+	state, transition := cb.currentLocked(now)
+	if generation != cb.generation {
+		// 请求发出之后熔断器已经换了状态，这个结果不再有参考价值
+		cb.mu.Unlock()
+		cb.notify(transition)
+		return
+	}
+
+	failed := err != nil && cb.config.IsFailure(err)
+	switch state {
+	case StateClosed:
+		cb.requests++
+		if failed {
+			cb.failures++
+			cb.consecutive++
+		} else {
+			cb.consecutive = 0
+		}
+		if cb.shouldTripLocked() {
+			transition = cb.setStateLocked(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failed {
+			transition = cb.setStateLocked(StateOpen, now)
+			break
+		}
+		cb.probeOK++
+		if cb.probeOK >= cb.config.HalfOpenProbes {
+			transition = cb.setStateLocked(StateClosed, now)
+		}
+	}
+	cb.mu.Unlock()
+
+	cb.notify(transition)
+}
+
+// shouldTripLocked 判断 Closed 状态下是否该熔断（调用方需持有锁）
+func (cb *CircuitBreaker) shouldTripLocked() bool {
+	if cb.config.ConsecutiveFailures > 0 && cb.consecutive >= cb.config.ConsecutiveFailures {
+		return true
+	}
+	if cb.config.FailureRatio > 0 && cb.requests >= cb.config.MinRequests && cb.requests > 0 {
+		return float64(cb.failures)/float64(cb.requests) >= cb.config.FailureRatio
+	}
+	return false
+}
+
+// stateChange 一次待通知的状态切换
+type stateChange struct {
+	from, to BreakerState
+	changed  bool
+}
+
+// currentLocked 处理随时间发生的变化（Open 超时、统计窗口到期），返回当前状态
+func (cb *CircuitBreaker) currentLocked(now time.Time) (BreakerState, stateChange) {
+	var transition stateChange
+	switch cb.state {
+	case StateOpen:
+		if now.Sub(cb.openedAt) >= cb.config.OpenTimeout {
+			transition = cb.setStateLocked(StateHalfOpen, now)
+		}
+	case StateClosed:
+		if cb.config.Window > 0 && now.Sub(cb.windowStart) >= cb.config.Window {
+			cb.resetCountsLocked(now)
+		}
+	}
+	return cb.state, transition
+}
+
+// setStateLocked 切换状态并清空计数（调用方需持有锁）
+func (cb *CircuitBreaker) setStateLocked(to BreakerState, now time.Time) stateChange {
+	from := cb.state
+	cb.state = to
+	cb.generation++
+	cb.resetCountsLocked(now)
+	if to == StateOpen {
+		cb.openedAt = now
+	}
+	return stateChange{from: from, to: to, changed: from != to}
+}
+
+// resetCountsLocked 清空统计（调用方需持有锁）
+func (cb *CircuitBreaker) resetCountsLocked(now time.Time) {
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+	cb.consecutive = 0
+	cb.probes = 0
+	cb.probeOK = 0
+}
+
+// notify 在锁外调用状态切换回调
+func (cb *CircuitBreaker) notify(transition stateChange) {
+	if transition.changed && cb.OnStateChange != nil {
+		cb.OnStateChange(transition.from, transition.to)
+	}
+}
+
+// ============================================
+// 演示: 服务挂掉时熔断，恢复后自动关闭
+// ============================================
+
+func circuitBreakerDemo() {
+	fmt.Println("📍 熔断器演示: 连续失败 3 次熔断，300ms 后试探")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	cb := NewCircuitBreaker(BreakerConfig{
+		ConsecutiveFailures: 3,
+		FailureRatio:        0.5,
+		MinRequests:         10,
+		Window:              10 * time.Second,
+		OpenTimeout:         300 * time.Millisecond,
+		HalfOpenProbes:      2,
+	})
+	cb.OnStateChange = func(from, to BreakerState) {
+		fmt.Printf("  🔌 熔断器: %s → %s\n", from, to)
+	}
+
+	serviceDown := true
+	calls := 0
+	service := func(ctx context.Context) (string, error) {
+		calls++
+		if serviceDown {
+			return "", &StatusError{StatusCode: 503, Message: "服务挂了"}
+		}
+		return "ok", nil
+	}
+
+	config := RetryConfig{
+		MaxRetries:     3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Timeout:        time.Second,
+		Hooks:          narrateHooks(3),
+	}
+
+	// 服务挂掉期间发 5 个请求
+	for i := 1; i <= 5; i++ {
+		_, err := Retry(context.Background(), config, WithBreaker(cb, service))
+		fmt.Printf("  请求 %d: %v\n", i, err)
+	}
+	fmt.Printf("  5 个请求 × 最多 3 次尝试，下游实际只收到 %d 次调用\n", calls)
+
+	// 服务恢复，等熔断器进入试探状态
+	serviceDown = false
+	time.Sleep(350 * time.Millisecond)
+	for i := 6; i <= 8; i++ {
+		result, err := Retry(context.Background(), config, WithBreaker(cb, service))
+		fmt.Printf("  请求 %d: %q %v（状态: %s）\n", i, result, err, cb.State())
+	}
+}
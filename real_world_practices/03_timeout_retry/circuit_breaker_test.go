@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 2, OpenTimeout: 20 * time.Millisecond})
+	fail := func(ctx context.Context) (string, error) { return "", errors.New("503") }
+	ok := func(ctx context.Context) (string, error) { return "ok", nil }
+
+	Execute(context.Background(), cb, fail)
+	Execute(context.Background(), cb, fail)
+	if state := cb.State(); state != StateOpen {
+		t.Fatalf("连续失败 2 次后状态 = %v，期望 open", state)
+	}
+	if _, err := Execute(context.Background(), cb, ok); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open 时 Execute = %v，期望 ErrCircuitOpen", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := Execute(context.Background(), cb, ok); err != nil {
+		t.Fatalf("half-open 探测失败: %v", err)
+	}
+	if state := cb.State(); state != StateClosed {
+		t.Errorf("探测成功后状态 = %v，期望 closed", state)
+	}
+}
+
+func TestCircuitBreakerProbePanicCountsAsFailure(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: 20 * time.Millisecond})
+	Execute(context.Background(), cb, func(ctx context.Context) (int, error) { return 0, errors.New("503") })
+
+	time.Sleep(30 * time.Millisecond) // 进入 half-open
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("operation 的 panic 应该继续向上传")
+			}
+		}()
+		Execute(context.Background(), cb, func(ctx context.Context) (int, error) { panic("boom") })
+	}()
+
+	// panic 的探测算一次失败：重新断开，而不是一直占着探测名额
+	if state := cb.State(); state != StateOpen {
+		t.Fatalf("探测 panic 后状态 = %v，期望 open", state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := Execute(context.Background(), cb, func(ctx context.Context) (int, error) { return 1, nil }); err != nil {
+		t.Fatalf("下一轮探测被拒绝: %v", err)
+	}
+	if state := cb.State(); state != StateClosed {
+		t.Errorf("探测成功后状态 = %v，期望 closed", state)
+	}
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	errUnavailable := &StatusError{StatusCode: 503, Message: "维护中"}
+	errNotFound := &StatusError{StatusCode: 404, Message: "不存在"}
+
+	tests := []struct {
+		name    string
+		results []error
+		want    BreakerState
+	}{
+		{"样本不够不判断比例", []error{errUnavailable, errUnavailable, errUnavailable}, StateClosed},
+		{"失败比例达到阈值", []error{errUnavailable, nil, errUnavailable, nil}, StateOpen},
+		{"失败比例不到阈值", []error{errUnavailable, nil, nil, nil}, StateClosed},
+		{"永久错误不算失败", []error{errNotFound, errNotFound, errNotFound, errNotFound}, StateClosed},
+		{"调用方取消不算失败", []error{context.Canceled, context.Canceled, errUnavailable, nil}, StateClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := NewCircuitBreaker(BreakerConfig{FailureRatio: 0.5, MinRequests: 4, OpenTimeout: time.Minute})
+			for _, result := range tt.results {
+				done, err := cb.Allow()
+				if err != nil {
+					t.Fatalf("Allow() = %v", err)
+				}
+				done(result)
+			}
+			if state := cb.State(); state != tt.want {
+				t.Errorf("状态 = %v，期望 %v", state, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerWindowResetsCounts(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Window:       50 * time.Millisecond,
+		OpenTimeout:  time.Minute,
+	})
+	fail := func(ctx context.Context) (int, error) { return 0, errors.New("503") }
+
+	for i := 0; i < 3; i++ {
+		Execute(context.Background(), cb, fail)
+	}
+	time.Sleep(70 * time.Millisecond) // 窗口到期，前 3 次失败清零
+
+	Execute(context.Background(), cb, fail)
+	if state := cb.State(); state != StateClosed {
+		t.Fatalf("新窗口只有 1 个请求，状态 = %v，期望 closed", state)
+	}
+	for i := 0; i < 3; i++ {
+		Execute(context.Background(), cb, fail)
+	}
+	if state := cb.State(); state != StateOpen {
+		t.Errorf("同一窗口 4 次失败后状态 = %v，期望 open", state)
+	}
+}
+
+func TestCircuitBreakerOnStateChange(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: 20 * time.Millisecond})
+	var changes []string
+	cb.OnStateChange = func(from, to BreakerState) {
+		changes = append(changes, from.String()+"→"+to.String())
+	}
+	fail := func(ctx context.Context) (int, error) { return 0, errors.New("503") }
+	ok := func(ctx context.Context) (int, error) { return 1, nil }
+
+	Execute(context.Background(), cb, fail) // closed → open
+	time.Sleep(30 * time.Millisecond)
+	Execute(context.Background(), cb, fail) // open → half-open，探测失败 → open
+	time.Sleep(30 * time.Millisecond)
+	Execute(context.Background(), cb, ok) // open → half-open，探测成功 → closed
+	Execute(context.Background(), cb, ok) // 状态没变，不回调
+
+	want := []string{
+		"closed→open",
+		"open→half-open", "half-open→open",
+		"open→half-open", "half-open→closed",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("回调 = %v，期望 %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("第 %d 次回调 = %s，期望 %s", i+1, changes[i], want[i])
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	newOpenBreaker := func(t *testing.T) *CircuitBreaker {
+		t.Helper()
+		cb := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: 20 * time.Millisecond, HalfOpenProbes: 2})
+		done, err := cb.Allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(errors.New("503"))
+		time.Sleep(30 * time.Millisecond)
+		if state := cb.State(); state != StateHalfOpen {
+			t.Fatalf("状态 = %v，期望 half-open", state)
+		}
+		return cb
+	}
+	allowProbes := func(t *testing.T, cb *CircuitBreaker) (func(error), func(error)) {
+		t.Helper()
+		first, err := cb.Allow()
+		if err != nil {
+			t.Fatalf("第 1 个探测被拒绝: %v", err)
+		}
+		second, err := cb.Allow()
+		if err != nil {
+			t.Fatalf("第 2 个探测被拒绝: %v", err)
+		}
+		// 名额用完，其他请求继续被拒绝
+		if _, err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("第 3 个请求 Allow() = %v，期望 ErrCircuitOpen", err)
+		}
+		return first, second
+	}
+
+	t.Run("探测全部成功才关闭", func(t *testing.T) {
+		cb := newOpenBreaker(t)
+		first, second := allowProbes(t, cb)
+		first(nil)
+		if state := cb.State(); state != StateHalfOpen {
+			t.Fatalf("只成功 1 个探测，状态 = %v，期望 half-open", state)
+		}
+		second(nil)
+		if state := cb.State(); state != StateClosed {
+			t.Errorf("2 个探测都成功，状态 = %v，期望 closed", state)
+		}
+	})
+
+	t.Run("任一探测失败就重新断开", func(t *testing.T) {
+		cb := newOpenBreaker(t)
+		first, second := allowProbes(t, cb)
+		first(errors.New("503"))
+		if state := cb.State(); state != StateOpen {
+			t.Fatalf("探测失败后状态 = %v，期望 open", state)
+		}
+		// 旧的探测结果不再影响新的状态
+		second(nil)
+		if state := cb.State(); state != StateOpen {
+			t.Errorf("过期的探测结果改变了状态: %v", state)
+		}
+		if _, err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("重新断开后 Allow() = %v，期望 ErrCircuitOpen", err)
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+🧪 可复现的故障注入
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+原来的 unstableService 用全局 rand、写死 70% 失败率、直接 time.Sleep，
+同一段重试代码每次跑结果都不一样，出了问题根本复现不了。
+
+故障注入工具把"这次调用会怎样"抽象成 Fault（延迟多久、返回什么错误、是否卡住不返回），
+由 FaultModel 决定每次调用拿到哪个 Fault:
+- Script:          按脚本走，比如 "失败、失败、超时、成功"
+- NewRandomFaults: 按概率随机，但随机数种子固定，每次运行结果完全一样
+
+拿到的 Fault 可以:
+- 用 Inject 套在任何 func(ctx) (T, error) 外面
+- 用 InjectHandler 套在任何 http.Handler 外面
+- 直接调用 Next() 拿结果而不真的 sleep（模拟器在虚拟时钟上用）
+*/
+
+// ErrConnectionReset 模拟连接被重置（HTTP 场景下会直接断开连接）
+var ErrConnectionReset = errors.New("连接被重置")
+
+// Fault 一次调用的结果
+type Fault struct {
+	Latency time.Duration // 多久之后返回
+	Err     error         // 返回的错误，nil 表示成功
+	Hang    bool          // 一直不返回，直到 ctx 被取消（模拟超时）
+}
+
+// OK 成功
+func OK() Fault { return Fault{} }
+
+// Fail 返回 err
+func Fail(err error) Fault { return Fault{Err: err} }
+
+// Hang 卡住不返回，直到调用方超时
+func Hang() Fault { return Fault{Hang: true} }
+
+// After 在 d 之后才返回
+func (f Fault) After(d time.Duration) Fault {
+	f.Latency = d
+	return f
+}
+
+// Apply 按 Fault 真实地等待，返回它的错误
+func (f Fault) Apply(ctx context.Context) error {
+	if f.Hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if err := sleepContext(ctx, f.Latency); err != nil {
+		return err
+	}
+	return f.Err
+}
+
+// FaultModel 决定每一次调用的结果
+type FaultModel interface {
+	Next() Fault
+}
+
+// ============================================
+// 脚本
+// ============================================
+
+// ScriptedFaults 按顺序返回预先写好的结果，脚本用完之后一直成功
+type ScriptedFaults struct {
+	mu     sync.Mutex
+	faults []Fault
+	calls  int
+}
+
+// Script 创建脚本，比如 Script(Fail(err), Fail(err), Hang(), OK())
+func Script(faults ...Fault) *ScriptedFaults {
+	return &ScriptedFaults{faults: faults}
+}
+
+// Next 实现 FaultModel
+func (s *ScriptedFaults) Next() Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls > len(s.faults) {
+		return OK()
+	}
+	return s.faults[s.calls-1]
+}
+
+// Calls 返回已经被调用了几次
+func (s *ScriptedFaults) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// ============================================
+// 按概率随机
+// ============================================
+
+// LatencyDist 延迟分布，用给定的随机源抽一个延迟
+type LatencyDist func(r *rand.Rand) time.Duration
+
+// ConstantLatency 固定延迟
+func ConstantLatency(d time.Duration) LatencyDist {
+	return func(*rand.Rand) time.Duration { return d }
+}
+
+// UniformLatency [lo, hi) 之间均匀分布
+func UniformLatency(lo, hi time.Duration) LatencyDist {
+	return func(r *rand.Rand) time.Duration {
+		if hi <= lo {
+			return lo
+		}
+		return lo + time.Duration(r.Int63n(int64(hi-lo)))
+	}
+}
+
+// ExponentialLatency 最少 floor，平均再多 mean 的指数分布（大部分很快，偶尔很慢）
+func ExponentialLatency(floor, mean time.Duration) LatencyDist {
+	return func(r *rand.Rand) time.Duration {
+		return floor + time.Duration(r.ExpFloat64()*float64(mean))
+	}
+}
+
+// LongTailLatency 大部分是 fast，slowRate 的概率是 slow（模拟 GC 停顿、慢查询）
+func LongTailLatency(fast, slow LatencyDist, slowRate float64) LatencyDist {
+	return func(r *rand.Rand) time.Duration {
+		if r.Float64() < slowRate {
+			return slow(r)
+		}
+		return fast(r)
+	}
+}
+
+// WeightedError 失败时按权重挑选的错误
+type WeightedError struct {
+	Err    error
+	Weight float64
+}
+
+// RandomFaultConfig 随机故障的配置
+type RandomFaultConfig struct {
+	Seed        int64           // 随机数种子，相同种子每次结果相同
+	FailureRate float64         // 返回错误的概率
+	HangRate    float64         // 卡住不返回的概率（在 FailureRate 之外）
+	Errors      []WeightedError // 失败时返回哪些错误，为空时返回 503
+	Latency     LatencyDist     // 延迟分布，nil 表示没有延迟
+}
+
+// RandomFaults 按概率随机产生结果，可以被多个 goroutine 共享
+type RandomFaults struct {
+	config RandomFaultConfig
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewRandomFaults 创建随机故障模型
+func NewRandomFaults(config RandomFaultConfig) *RandomFaults {
+	return &RandomFaults{
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// Next 实现 FaultModel
+func (m *RandomFaults) Next() Fault {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var fault Fault
+	if m.config.Latency != nil {
+		fault.Latency = m.config.Latency(m.rng)
+	}
+
+	roll := m.rng.Float64()
+	switch {
+	case roll < m.config.FailureRate:
+		fault.Err = m.pickError()
+	case roll < m.config.FailureRate+m.config.HangRate:
+		fault.Hang = true
+	}
+	return fault
+}
+
+// pickError 按权重挑一个错误（调用方需持有锁）
+func (m *RandomFaults) pickError() error {
+	total := 0.0
+	for _, e := range m.config.Errors {
+		total += e.Weight
+	}
+	if total <= 0 {
+		return &StatusError{StatusCode: http.StatusServiceUnavailable, Message: "服务暂时不可用"}
+	}
+
+	roll := m.rng.Float64() * total
+	for _, e := range m.config.Errors {
+		roll -= e.Weight
+		if roll < 0 {
+			return e.Err
+		}
+	}
+	return m.config.Errors[len(m.config.Errors)-1].Err
+}
+
+// ============================================
+// 注入到函数和 HTTP 服务
+// ============================================
+
+// Inject 在 operation 外面套上故障：先按 Fault 等待，出错就直接返回，否则调用 operation
+func Inject[T any](model FaultModel, operation func(ctx context.Context) (T, error)) func(ctx context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		if err := model.Next().Apply(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+		return operation(ctx)
+	}
+}
+
+// InjectHandler 在 next 外面套上故障
+// *StatusError 变成对应的状态码（RetryAfter 变成 Retry-After 头），
+// ErrConnectionReset 直接断开连接，其它错误返回 500
+func InjectHandler(model FaultModel, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := model.Next().Apply(r.Context())
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if errors.Is(err, ErrConnectionReset) {
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, hijackErr := hijacker.Hijack(); hijackErr == nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+		if delay, ok := RetryAfterDelay(err); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		}
+
+		code := http.StatusInternalServerError
+		var status *StatusError
+		if errors.As(err, &status) {
+			code = status.StatusCode
+		}
+		http.Error(w, err.Error(), code)
+	})
+}
+
+// ============================================
+// 演示: 脚本化故障 + 固定种子的随机故障
+// ============================================
+
+func faultInjectionDemo() {
+	fmt.Println("📍 故障注入演示")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	config := RetryConfig{
+		MaxRetries:     5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Timeout:        2 * time.Second,
+		AttemptTimeout: 100 * time.Millisecond,
+		Hooks:          narrateHooks(5),
+	}
+
+	// 1. 脚本: 失败、失败、超时、成功
+	fmt.Println("🔄 脚本: 503、503、卡住、成功")
+	unavailable := &StatusError{StatusCode: 503, Message: "服务暂时不可用"}
+	script := Script(Fail(unavailable), Fail(unavailable).After(20*time.Millisecond), Hang(), OK())
+	result, err := Retry(context.Background(), config, Inject(script, func(ctx context.Context) (string, error) {
+		return "订单数据", nil
+	}))
+	fmt.Printf("  结果: %q %v，共调用 %d 次\n", result, err, script.Calls())
+
+	// 2. 固定种子: 跑两遍，结果一模一样
+	fmt.Println("🔄 固定种子的随机故障（70% 失败，错误混合 503/429/连接重置），同一种子跑两遍:")
+	for run := 1; run <= 2; run++ {
+		model := NewRandomFaults(RandomFaultConfig{
+			Seed:        2024,
+			FailureRate: 0.7,
+			Errors: []WeightedError{
+				{&StatusError{StatusCode: 503, Message: "服务暂时不可用"}, 6},
+				{RetryAfter(&StatusError{StatusCode: 429, Message: "请求太频繁"}, time.Second), 2},
+				{ErrConnectionReset, 2},
+			},
+			Latency: UniformLatency(50*time.Millisecond, 250*time.Millisecond),
+		})
+		var outcomes []string
+		for i := 0; i < 8; i++ {
+			fault := model.Next() // 只取结果，不真的等待
+			switch {
+			case fault.Err == nil:
+				outcomes = append(outcomes, fmt.Sprintf("✅%v", fault.Latency.Round(time.Millisecond)))
+			default:
+				outcomes = append(outcomes, "❌"+strings.SplitN(fault.Err.Error(), ":", 2)[0])
+			}
+		}
+		fmt.Printf("  第 %d 遍: %s\n", run, strings.Join(outcomes, " "))
+	}
+	fmt.Println("💡 InjectHandler 的用法（断开连接、503、成功）见 fault_injection_test.go")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// faultSequence 从 model 里取 n 个结果（只取结果，不真的等待）
+func faultSequence(model FaultModel, n int) []Fault {
+	faults := make([]Fault, n)
+	for i := range faults {
+		faults[i] = model.Next()
+	}
+	return faults
+}
+
+func TestScriptedFaultsDriveRetry(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable, Message: "服务暂时不可用"}
+	script := Script(Fail(unavailable), Fail(unavailable).After(5*time.Millisecond), Hang(), OK())
+	config := RetryConfig{
+		MaxRetries:     5,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Timeout:        time.Second,
+		AttemptTimeout: 20 * time.Millisecond,
+	}
+
+	result, history, err := RetryWithHistory(context.Background(), config, Inject(script, func(ctx context.Context) (string, error) {
+		return "订单数据", nil
+	}))
+	if err != nil || result != "订单数据" {
+		t.Fatalf("Retry = (%q, %v)，期望成功", result, err)
+	}
+	if got := script.Calls(); got != 4 {
+		t.Errorf("调用了 %d 次，期望 4 次", got)
+	}
+
+	var classes []ErrorClass
+	for _, record := range history[:len(history)-1] {
+		classes = append(classes, record.Class)
+	}
+	if want := []ErrorClass{ClassTransient, ClassTransient, ClassTimeout}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("失败的分类 = %v，期望 %v", classes, want)
+	}
+}
+
+func TestRandomFaultsAreReproducible(t *testing.T) {
+	config := RandomFaultConfig{
+		Seed:        7,
+		FailureRate: 0.5,
+		HangRate:    0.1,
+		Errors:      []WeightedError{{ErrConnectionReset, 1}, {context.DeadlineExceeded, 1}},
+		Latency:     ExponentialLatency(time.Millisecond, 10*time.Millisecond),
+	}
+
+	first := faultSequence(NewRandomFaults(config), 100)
+	if second := faultSequence(NewRandomFaults(config), 100); !reflect.DeepEqual(first, second) {
+		t.Error("相同种子的两次序列不一样")
+	}
+
+	config.Seed = 8
+	if other := faultSequence(NewRandomFaults(config), 100); reflect.DeepEqual(first, other) {
+		t.Error("不同种子的序列完全一样")
+	}
+
+	var failures, hangs int
+	for _, fault := range first {
+		switch {
+		case fault.Hang:
+			hangs++
+		case fault.Err != nil:
+			failures++
+		}
+	}
+	if failures < 30 || failures > 70 || hangs == 0 {
+		t.Errorf("100 次里失败 %d 次、卡住 %d 次，和配置的比例差太多", failures, hangs)
+	}
+}
+
+func TestUnstableServiceIsSeeded(t *testing.T) {
+	first := faultSequence(NewRandomFaults(unstableFaultConfig), 20)
+	second := faultSequence(NewRandomFaults(unstableFaultConfig), 20)
+	if !reflect.DeepEqual(first, second) {
+		t.Error("unstableService 的故障序列每次都不一样，没法复现")
+	}
+}
+
+func TestInjectHandlerWithRetryTransport(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable, Message: "服务暂时不可用"}
+	script := Script(Fail(ErrConnectionReset), Fail(unavailable), OK())
+	server := httptest.NewServer(InjectHandler(script, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(5))}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("响应 = %d %q，期望 200 \"ok\"", resp.StatusCode, body)
+	}
+	if got := script.Calls(); got != 3 {
+		t.Errorf("服务端收到 %d 次请求，期望 3 次", got)
+	}
+}
+
+func TestInjectHandlerRetryAfter(t *testing.T) {
+	throttled := RetryAfter(&StatusError{StatusCode: http.StatusTooManyRequests, Message: "请求太频繁"}, 1500*time.Millisecond)
+	server := httptest.NewServer(InjectHandler(Script(Fail(throttled)), http.NotFoundHandler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("响应 = %d Retry-After=%q，期望 429 和向上取整的 \"2\"", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestFaultApplyHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := Hang().Apply(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Hang().Apply = %v，期望 context.DeadlineExceeded", err)
+	}
+	if err := OK().After(time.Hour).Apply(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("OK().After(1h).Apply = %v，期望 context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ctx 结束后 %v 才返回", elapsed)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+🏇 对冲请求 (Hedged Requests)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+重试解决的是"失败"，对冲解决的是"慢"。
+大部分请求 50ms 就返回，偶尔一个卡了 1 秒 —— 等它超时再重试，用户已经等了 1 秒。
+
+对冲的做法：第一个请求发出后，如果过了 Delay（比如 P95 延迟）还没返回，
+就再发一个一模一样的请求，谁先成功用谁，剩下的取消掉。
+只有最慢的 5% 会多发一次请求，额外负载很小，尾延迟却大幅下降。
+
+和 03_channel_select 练习 5 的改进版一样，都是"多个请求，第一个结果胜出，通知其余停止"，
+区别是:
+- 不是同时发出，而是错开 Delay，大部分时候只发一个
+- 用 context 取消其余尝试，而不是自己维护 done channel
+- 最多同时 MaxAttempts 个，不会无限制地发
+- 某个尝试失败时立即发下一个，不用等 Delay；不该重试的错误（分类规则和 Retry 一样）不再发新的
+
+⚠️ 只能用在幂等的操作上（查询、读取），下单、扣款不能对冲！
+*/
+
+// HedgeConfig 对冲配置
+type HedgeConfig struct {
+	MaxAttempts int           // 最多发出几个请求（包含第一个）
+	Delay       time.Duration // 上一个请求多久没返回就发下一个，一般取 P95 延迟
+
+	Classify Classifier   // 可选：错误分类，nil 时使用 DefaultClassifier
+	RetryOn  []ErrorClass // 可选：含义同 RetryConfig.RetryOn，其它类别的错误不再发出新的尝试
+}
+
+// hedgeResult 一个尝试的结果
+type hedgeResult[T any] struct {
+	value T
+	err   error
+}
+
+// Hedge 对冲执行 operation，返回第一个成功的结果
+//
+// 返回时其余尝试的 ctx 已被取消；它们的结果发往带缓冲的 channel，
+// 所以只要 operation 理会 ctx，这些 goroutine 都会自己退出，不会泄漏。
+// 所有尝试都失败时返回 *RetryError；遇到不该重试的错误时立即返回，不再发出新的尝试。
+func Hedge[T any](ctx context.Context, config HedgeConfig, operation func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+
+	maxAttempts := config.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	classify := config.Classify
+	if classify == nil {
+		classify = DefaultClassifier
+	}
+	retryable := RetryConfig{RetryOn: config.RetryOn}.retryable
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // 返回时取消还在执行的尝试
+
+	results := make(chan hedgeResult[T], maxAttempts) // 带缓冲，晚到的结果不会阻塞
+	launch := func() {
+		go func() {
+			value, err := operation(ctx)
+			results <- hedgeResult[T]{value, err}
+		}()
+	}
+
+	launched, finished := 1, 0
+	launch()
+
+	timer := time.NewTimer(config.Delay)
+	defer timer.Stop()
+
+	failure := &RetryError{}
+	for {
+		select {
+		case result := <-results:
+			finished++
+			if result.err == nil {
+				return result.value, nil
+			}
+			failure.Attempts = append(failure.Attempts, result.err)
+
+			if !retryable(classify(result.err)) {
+				return zero, failure
+			}
+			if launched < maxAttempts {
+				// 失败了就立即发下一个，不用等 Delay
+				launched++
+				launch()
+				resetTimer(timer, config.Delay)
+			} else if finished == launched {
+				return zero, failure
+			}
+
+		case <-timer.C:
+			if launched < maxAttempts {
+				launched++
+				launch()
+				timer.Reset(config.Delay)
+			}
+
+		case <-ctx.Done():
+			failure.Reason = ctx.Err()
+			return zero, failure
+		}
+	}
+}
+
+// resetTimer 安全地重置一个可能已经触发过的 timer
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// ============================================
+// 演示: 对冲把 P95 从 1 秒降到 150ms 左右
+// ============================================
+
+func hedgeDemo() {
+	fmt.Println("📍 对冲请求演示: 90% 的请求 50ms 返回，10% 卡 1 秒；100ms 没返回就发第二个")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	var mu sync.Mutex
+	calls := 0
+	slowRead := func(ctx context.Context) (string, error) {
+		mu.Lock()
+		calls++
+		slow := rand.Float32() < 0.1
+		mu.Unlock()
+
+		delay := 50 * time.Millisecond
+		if slow {
+			delay = time.Second
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return "data", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	measure := func(name string, call func(ctx context.Context) (string, error)) {
+		mu.Lock()
+		calls = 0
+		mu.Unlock()
+
+		const requests = 100
+		latencies := make([]time.Duration, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				start := time.Now()
+				call(context.Background())
+				latencies[i] = time.Since(start)
+			}(i)
+		}
+		wg.Wait()
+
+		sort.Slice(latencies, func(a, b int) bool { return latencies[a] < latencies[b] })
+		mu.Lock()
+		fmt.Printf("  %s P50 %-6v P95 %-6v P99 %-6v 下游调用 %d 次\n", name,
+			latencies[requests/2].Round(10*time.Millisecond),
+			latencies[requests*95/100].Round(10*time.Millisecond),
+			latencies[requests*99/100].Round(10*time.Millisecond),
+			calls)
+		mu.Unlock()
+	}
+
+	measure("不对冲:", slowRead)
+	measure("对冲:  ", func(ctx context.Context) (string, error) {
+		return Hedge(ctx, HedgeConfig{MaxAttempts: 2, Delay: 100 * time.Millisecond}, slowRead)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeStaggersAttemptsAndCancelsLosers(t *testing.T) {
+	const delay = 40 * time.Millisecond
+	start := time.Now()
+
+	var mu sync.Mutex
+	var launchedAt []time.Duration
+	cancelled := make(chan int, 3)
+
+	result, err := Hedge(context.Background(), HedgeConfig{MaxAttempts: 3, Delay: delay},
+		func(ctx context.Context) (int, error) {
+			mu.Lock()
+			launchedAt = append(launchedAt, time.Since(start))
+			n := len(launchedAt)
+			mu.Unlock()
+
+			if n == 3 {
+				return n, nil
+			}
+			<-ctx.Done() // 前两个一直卡着，直到被取消
+			cancelled <- n
+			return 0, ctx.Err()
+		})
+	if err != nil || result != 3 {
+		t.Fatalf("Hedge() = %v, %v，期望第 3 个尝试的结果", result, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(launchedAt) != 3 {
+		t.Fatalf("发出了 %d 个尝试，期望 3 个", len(launchedAt))
+	}
+	for i := 1; i < len(launchedAt); i++ {
+		if gap := launchedAt[i] - launchedAt[i-1]; gap < delay*3/4 {
+			t.Errorf("第 %d 个尝试只比上一个晚 %v，期望错开约 %v", i+1, gap, delay)
+		}
+	}
+
+	// 返回之后，输掉的尝试都被取消
+	for i := 0; i < 2; i++ {
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("没赢的尝试没有被取消")
+		}
+	}
+}
+
+func TestHedgeLaunchesNextImmediatelyAfterFailure(t *testing.T) {
+	var calls int32
+	start := time.Now()
+	_, err := Hedge(context.Background(), HedgeConfig{MaxAttempts: 2, Delay: time.Second},
+		func(ctx context.Context) (string, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return "", &StatusError{StatusCode: 503, Message: "维护中"}
+			}
+			return "ok", nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("第一个失败后等了 %v 才发第二个，应该立即发", elapsed)
+	}
+}
+
+func TestHedgeStopsAtMaxAttempts(t *testing.T) {
+	var calls int32
+	_, err := Hedge(context.Background(), HedgeConfig{MaxAttempts: 3, Delay: time.Millisecond},
+		func(ctx context.Context) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(5 * time.Millisecond)
+			return "", &StatusError{StatusCode: 503, Message: "维护中"}
+		})
+
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("err = %v，期望 *RetryError", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("调用了 %d 次，期望最多 3 次", got)
+	}
+	if len(retryErr.Attempts) != 3 {
+		t.Errorf("RetryError 记录了 %d 次尝试，期望 3 次", len(retryErr.Attempts))
+	}
+}
+
+func TestHedgeStopsOnNonRetryableError(t *testing.T) {
+	errInvalid := errors.New("参数错误")
+	tests := []struct {
+		name   string
+		config HedgeConfig
+		err    error
+	}{
+		{"默认分类: 4xx", HedgeConfig{}, &StatusError{StatusCode: 404, Message: "不存在"}},
+		{"默认分类: Permanent", HedgeConfig{}, Permanent(errInvalid)},
+		{
+			"自定义 Classify",
+			HedgeConfig{Classify: func(err error) ErrorClass {
+				if errors.Is(err, errInvalid) {
+					return ClassPermanent
+				}
+				return ClassTransient
+			}},
+			errInvalid,
+		},
+		{"RetryOn 不包含这一类", HedgeConfig{RetryOn: []ErrorClass{ClassTimeout}}, &StatusError{StatusCode: 503, Message: "维护中"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.MaxAttempts, config.Delay = 3, time.Second
+
+			var calls int32
+			_, err := Hedge(context.Background(), config, func(ctx context.Context) (string, error) {
+				atomic.AddInt32(&calls, 1)
+				return "", tt.err
+			})
+			if err == nil || !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v，期望包含 %v", err, tt.err)
+			}
+			if got := atomic.LoadInt32(&calls); got != 1 {
+				t.Errorf("调用了 %d 次，不该重试的错误不应该再发新的尝试", got)
+			}
+		})
+	}
+}
+
+func TestHedgeRespectsContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	_, err := Hedge(ctx, HedgeConfig{MaxAttempts: 2, Delay: 10 * time.Millisecond},
+		func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond) // 不及时返回也不影响 Hedge 按时返回
+			return "", ctx.Err()
+		})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v，期望 context.DeadlineExceeded", err)
+	}
+}
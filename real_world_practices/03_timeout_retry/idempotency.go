@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+🔑 幂等键 (Idempotency Key)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+重试最危险的场景：下单请求其实成功了，只是响应在路上丢了。
+客户端看到的是超时 / 连接断开，于是重试 —— 用户被扣了两次钱。
+
+解决办法是给"一次业务操作"一个唯一的幂等键:
+- 客户端: 第一次尝试前生成一个键，之后每次重试都带同一个键
+- 服务端: 记录"键 → 结果"，同一个键再来时不再执行，直接返回上次的结果
+- 同一个键正在执行时又来了一个（客户端超时后马上重试），后来的等前一个执行完，用它的结果；
+  前一个的结果没有保存下来（临时错误、被取消、panic），后来的就自己重新执行
+
+🔨 实现:
+1. WithIdempotencyKey 把键放进 ctx，RetryIdempotent 保证所有尝试拿到的是同一个键
+2. RetryTransport 会把 ctx 里的键写进 Idempotency-Key 请求头，带键的 POST 也可以安全重试
+3. 服务端用 IdempotentExecutor 执行，结果存在 IdempotencyStore 里
+
+💡 只保存成功和永久错误的结果；临时错误不保存，客户端重试时会重新执行。
+⚠️ "执行中"的状态只在当前进程内共享，多实例部署时需要把它也放进共享存储（比如 Redis SETNX）。
+*/
+
+// IdempotencyKeyHeader 携带幂等键的 HTTP 头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrMissingIdempotencyKey 请求没有带幂等键
+var ErrMissingIdempotencyKey = errors.New("缺少幂等键")
+
+// idempotencyKeyCtx ctx 里存放幂等键的 key 类型
+type idempotencyKeyCtx struct{}
+
+// NewIdempotencyKey 生成一个随机的幂等键
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand 读取失败几乎不可能发生，退化为时间戳也比没有键强
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithIdempotencyKey 把幂等键放进 ctx
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// IdempotencyKeyFrom 取出 ctx 里的幂等键
+func IdempotencyKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key, ok && key != ""
+}
+
+// RetryIdempotent 同 Retry，但保证所有尝试的 ctx 里都带着同一个幂等键
+// ctx 里已经有键时沿用，没有时生成一个新的
+func RetryIdempotent[T any](ctx context.Context, config RetryConfig, operation func(ctx context.Context) (T, error)) (T, error) {
+	if _, ok := IdempotencyKeyFrom(ctx); !ok {
+		ctx = WithIdempotencyKey(ctx, NewIdempotencyKey())
+	}
+	return Retry(ctx, config, operation)
+}
+
+// ============================================
+// 服务端: 存储
+// ============================================
+
+// IdempotencyStore 保存"幂等键 → 结果"
+// 方法签名和 04_simple_cache 的 Cache 一致，Cache 实现之后可以直接当存储用
+type IdempotencyStore interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+}
+
+// IdempotencyRecord 存储里保存的一次执行结果
+type IdempotencyRecord struct {
+	Value         json.RawMessage `json:"value,omitempty"`          // 成功时的结果（JSON）
+	Err           string          `json:"error,omitempty"`          // 永久错误的信息
+	StatusCode    int             `json:"status_code,omitempty"`    // 永久错误里 *StatusError 的状态码
+	StatusMessage string          `json:"status_message,omitempty"` // 永久错误里 *StatusError 的信息
+	CreatedAt     time.Time       `json:"created_at"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+}
+
+// ReplayedError 重放的永久错误
+// 原始的错误类型无法保存，只保留信息；原始错误里有 *StatusError 时会还原出来，
+// 所以重放的错误照样可以用 errors.As 取出状态码
+type ReplayedError struct {
+	Message string
+	Status  *StatusError // 原始错误里的 HTTP 状态，没有时为 nil
+}
+
+func (e *ReplayedError) Error() string { return e.Message }
+
+// Unwrap 让 errors.As 能找到还原出来的 *StatusError
+func (e *ReplayedError) Unwrap() error {
+	if e.Status == nil {
+		return nil
+	}
+	return e.Status
+}
+
+// FileStore 把每个键的结果存成一个 JSON 文件，进程重启后仍然有效
+// 只能保存 IdempotencyRecord，供 IdempotentExecutor 使用
+type FileStore struct {
+	dir string
+
+	mu sync.Mutex
+
+	// OnError 读写文件失败时回调（可选）
+	OnError func(err error)
+}
+
+// NewFileStore 创建文件存储，dir 不存在时会自动创建
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建幂等存储目录失败: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Get 读取键对应的记录，过期的记录视为不存在
+func (s *FileStore) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.reportError(fmt.Errorf("读取幂等记录失败: %w", err))
+		}
+		return nil, false
+	}
+
+	var record IdempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		s.reportError(fmt.Errorf("解析幂等记录 %s 失败: %w", key, err))
+		return nil, false
+	}
+	if !record.ExpiresAt.IsZero() && time.Now().After(record.ExpiresAt) {
+		os.Remove(s.path(key))
+		return nil, false
+	}
+	return record, true
+}
+
+// Set 保存记录
+func (s *FileStore) Set(key string, value interface{}, ttl time.Duration) {
+	record, ok := value.(IdempotencyRecord)
+	if !ok {
+		s.reportError(fmt.Errorf("FileStore 只能保存 IdempotencyRecord，收到 %T", value))
+		return
+	}
+	if ttl > 0 {
+		record.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		s.reportError(fmt.Errorf("序列化幂等记录失败: %w", err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先写临时文件再 rename，避免写到一半被读到
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		s.reportError(fmt.Errorf("保存幂等记录失败: %w", err))
+		return
+	}
+	if err := os.Rename(tmp, s.path(key)); err != nil {
+		s.reportError(fmt.Errorf("保存幂等记录失败: %w", err))
+	}
+}
+
+// Delete 删除记录
+func (s *FileStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	os.Remove(s.path(key))
+}
+
+// path 键对应的文件（键来自客户端，先做 hex 编码，防止 "../" 之类的路径）
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(key))+".json")
+}
+
+// reportError 调用错误回调
+func (s *FileStore) reportError(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// memoryStore 演示用的内存存储（04_simple_cache 的 Cache 是另一个 main 包，这里没法直接引用）
+// 过期的记录在 Get 时删除
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryEntry
+}
+
+// memoryEntry 内存存储里的一条记录
+type memoryEntry struct {
+	value     interface{}
+	expiresAt time.Time // 零值表示永不过期
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[string]memoryEntry)}
+}
+
+func (s *memoryStore) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.records[key]
+	if !ok {
+		return nil, false
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(s.records, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set 保存记录，ttl <= 0 表示永不过期
+func (s *memoryStore) Set(key string, value interface{}, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	s.records[key] = entry
+}
+
+func (s *memoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+}
+
+// ============================================
+// 服务端: 执行器
+// ============================================
+
+// idempotentCall 一次正在执行的调用
+type idempotentCall[T any] struct {
+	done   chan struct{}
+	result T
+	err    error
+	stored bool // 结果是否已经存进 store；没存的结果不能给等待者重放
+}
+
+// IdempotentExecutor 按幂等键执行操作：同一个键只执行一次，之后重放结果
+type IdempotentExecutor[T any] struct {
+	store IdempotencyStore
+	ttl   time.Duration // 结果保存多久
+
+	mu       sync.Mutex
+	inflight map[string]*idempotentCall[T]
+}
+
+// NewIdempotentExecutor 创建执行器，结果在 store 里保存 ttl
+func NewIdempotentExecutor[T any](store IdempotencyStore, ttl time.Duration) *IdempotentExecutor[T] {
+	return &IdempotentExecutor[T]{
+		store:    store,
+		ttl:      ttl,
+		inflight: make(map[string]*idempotentCall[T]),
+	}
+}
+
+// Do 用 key 执行 operation
+// replayed 为 true 表示这次没有真正执行，结果来自之前（或正在进行）的同键调用
+func (e *IdempotentExecutor[T]) Do(ctx context.Context, key string, operation func(ctx context.Context) (T, error)) (result T, replayed bool, err error) {
+	if key == "" {
+		return result, false, ErrMissingIdempotencyKey
+	}
+
+	for {
+		// 存储可能要读文件或走网络，不持有 e.mu 查，免得拖慢其他键
+		if value, ok := e.store.Get(key); ok {
+			result, err = e.decode(value)
+			return result, true, err
+		}
+
+		e.mu.Lock()
+		call, ok := e.inflight[key]
+		if !ok {
+			call = &idempotentCall[T]{done: make(chan struct{})}
+			e.inflight[key] = call
+			e.mu.Unlock()
+
+			// 上面查存储之后、登记"执行中"之前，同键的上一次调用可能刚好保存完结果并移除了标记，
+			// 它总是先保存再移除标记，所以登记之后再查一次就不会漏掉
+			if value, ok := e.store.Get(key); ok {
+				call.result, call.err = e.decode(value)
+				call.stored = true
+				e.release(key, call)
+				return call.result, true, call.err
+			}
+
+			result, err = e.execute(ctx, key, call, operation)
+			return result, false, err
+		}
+		e.mu.Unlock()
+
+		// 同一个键正在执行，等它的结果
+		select {
+		case <-call.done:
+			if call.stored {
+				return call.result, true, call.err
+			}
+			// 它的临时错误、ctx 取消、panic 都不是这个请求的结果，回到开头重新来（很可能自己执行）
+		case <-ctx.Done():
+			return result, false, ctx.Err()
+		}
+	}
+}
+
+// execute 真正执行 operation
+// 收尾放在 defer 里，operation panic 时也会移除"执行中"标记并唤醒等待者，不会让同一个键永远卡住
+func (e *IdempotentExecutor[T]) execute(ctx context.Context, key string, call *idempotentCall[T], operation func(ctx context.Context) (T, error)) (T, error) {
+	call.err = errOperationPanicked // operation 正常返回时会被覆盖；panic 时不会被当成成功保存
+	defer func() {
+		// 先保存结果，再移除"执行中"标记，中间不会有请求漏过去重复执行
+		if record, ok := e.encode(call.result, call.err); ok {
+			e.store.Set(key, record, e.ttl)
+			call.stored = true
+		}
+		e.release(key, call)
+	}()
+
+	call.result, call.err = operation(ctx)
+	return call.result, call.err
+}
+
+// release 移除"执行中"标记并唤醒等待同一个键的请求
+func (e *IdempotentExecutor[T]) release(key string, call *idempotentCall[T]) {
+	e.mu.Lock()
+	delete(e.inflight, key)
+	e.mu.Unlock()
+	close(call.done)
+}
+
+// encode 把结果转成可保存的记录；临时错误不保存
+func (e *IdempotentExecutor[T]) encode(result T, err error) (IdempotencyRecord, bool) {
+	record := IdempotencyRecord{CreatedAt: time.Now()}
+	if err != nil {
+		if DefaultClassifier(err) != ClassPermanent {
+			return record, false
+		}
+		record.Err = err.Error()
+		var status *StatusError
+		if errors.As(err, &status) {
+			record.StatusCode, record.StatusMessage = status.StatusCode, status.Message
+		}
+		return record, true
+	}
+
+	value, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return record, false // 存不下就不存，下次重新执行
+	}
+	record.Value = value
+	return record, true
+}
+
+// decode 把保存的记录还原成结果
+func (e *IdempotentExecutor[T]) decode(value interface{}) (T, error) {
+	var result T
+
+	record, ok := value.(IdempotencyRecord)
+	if !ok {
+		return result, fmt.Errorf("幂等存储里的记录类型不对: %T", value)
+	}
+	if record.Err != "" {
+		replayed := &ReplayedError{Message: record.Err}
+		if record.StatusCode != 0 {
+			replayed.Status = &StatusError{StatusCode: record.StatusCode, Message: record.StatusMessage}
+		}
+		return result, Permanent(replayed)
+	}
+	if err := json.Unmarshal(record.Value, &result); err != nil {
+		return result, fmt.Errorf("解析保存的结果失败: %w", err)
+	}
+	return result, nil
+}
+
+// ============================================
+// 演示: 响应丢失时，重试不会重复下单
+// ============================================
+
+func idempotencyDemo() {
+	fmt.Println("📍 幂等键演示: 下单成功了，但响应在路上丢失，客户端重试")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	type Order struct {
+		ID     int    `json:"id"`
+		Item   string `json:"item"`
+		Amount int    `json:"amount"`
+	}
+
+	config := RetryConfig{
+		MaxRetries:     5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Timeout:        2 * time.Second,
+	}
+
+	run := func(name string, useKey bool) {
+		var mu sync.Mutex
+		orders := 0
+		executor := NewIdempotentExecutor[Order](newMemoryStore(), time.Hour)
+		// 第 2、4 单的响应各丢一次，第 5 单连丢两次
+		lost := Fail(ErrConnectionReset)
+		lostResponses := Script(OK(), lost, OK(), OK(), lost, OK(), lost, lost)
+
+		// 服务端真正的下单逻辑
+		createOrder := func(ctx context.Context) (Order, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			orders++
+			return Order{ID: orders, Item: "book", Amount: 42}, nil
+		}
+
+		// 客户端看到的调用：服务端执行完之后，响应可能丢失
+		call := func(ctx context.Context) (Order, error) {
+			var order Order
+			var err error
+			if key, ok := IdempotencyKeyFrom(ctx); ok && useKey {
+				order, _, err = executor.Do(ctx, key, createOrder)
+			} else {
+				order, err = createOrder(ctx)
+			}
+			if err != nil {
+				return order, err
+			}
+			if err := lostResponses.Next().Err; err != nil {
+				return Order{}, err
+			}
+			return order, nil
+		}
+
+		for i := 0; i < 5; i++ {
+			if _, err := RetryIdempotent(context.Background(), config, call); err != nil {
+				fmt.Printf("  ❌ %v\n", err)
+			}
+		}
+		fmt.Printf("  %s: 用户下了 5 单，服务端实际创建了 %d 单\n", name, orders)
+	}
+
+	run("不用幂等键", false)
+	run("使用幂等键", true)
+
+	// 同一个键并发到达: 后到的等先到的执行完，共用结果
+	executor := NewIdempotentExecutor[string](newMemoryStore(), time.Hour)
+	var executed, replayedCount int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, replayed, _ := executor.Do(context.Background(), "pay-123", func(ctx context.Context) (string, error) {
+				time.Sleep(100 * time.Millisecond) // 扣款比较慢
+				mu.Lock()
+				executed++
+				mu.Unlock()
+				return "paid", nil
+			})
+			if replayed {
+				mu.Lock()
+				replayedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("  同一个键并发 5 次: 执行 %d 次，其余 %d 次复用了结果\n", executed, replayedCount)
+}
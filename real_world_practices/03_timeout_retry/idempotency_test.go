@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotentExecutorRunsConcurrentDuplicatesOnce(t *testing.T) {
+	executor := NewIdempotentExecutor[string](newMemoryStore(), time.Hour)
+	var executed, replayed atomic.Int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, isReplay, err := executor.Do(context.Background(), "pay-1", func(ctx context.Context) (string, error) {
+				executed.Add(1)
+				time.Sleep(50 * time.Millisecond)
+				return "paid", nil
+			})
+			if err != nil || result != "paid" {
+				t.Errorf("Do = (%q, %v)，期望 paid", result, err)
+			}
+			if isReplay {
+				replayed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if executed.Load() != 1 || replayed.Load() != 9 {
+		t.Errorf("执行 %d 次、重放 %d 次，期望 1 次和 9 次", executed.Load(), replayed.Load())
+	}
+}
+
+func TestIdempotentExecutorReplaysPermanentError(t *testing.T) {
+	executor := NewIdempotentExecutor[string](newMemoryStore(), time.Hour)
+	calls := 0
+	operation := func(ctx context.Context) (string, error) {
+		calls++
+		return "", &StatusError{StatusCode: http.StatusBadRequest, Message: "余额不足"}
+	}
+
+	executor.Do(context.Background(), "pay-2", operation)
+	_, replayed, err := executor.Do(context.Background(), "pay-2", operation)
+
+	if calls != 1 || !replayed {
+		t.Errorf("执行 %d 次、replayed=%v，期望只执行 1 次，第二次重放", calls, replayed)
+	}
+	var replayedErr *ReplayedError
+	if !errors.As(err, &replayedErr) || DefaultClassifier(err) != ClassPermanent {
+		t.Errorf("重放的错误 = %v，期望永久的 *ReplayedError", err)
+	}
+	// 原始的 *StatusError 也能取出来
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusBadRequest || status.Message != "余额不足" {
+		t.Errorf("重放的错误里的 StatusError = %+v，期望 400 余额不足", status)
+	}
+}
+
+func TestIdempotentExecutorDoesNotStoreTransientErrors(t *testing.T) {
+	executor := NewIdempotentExecutor[string](newMemoryStore(), time.Hour)
+	calls := 0
+	operation := func(ctx context.Context) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", ErrConnectionReset
+		}
+		return "paid", nil
+	}
+
+	if _, _, err := executor.Do(context.Background(), "pay-3", operation); !errors.Is(err, ErrConnectionReset) {
+		t.Fatalf("第一次 Do 的错误 = %v，期望 ErrConnectionReset", err)
+	}
+	result, replayed, err := executor.Do(context.Background(), "pay-3", operation)
+	if err != nil || result != "paid" || replayed {
+		t.Errorf("第二次 Do = (%q, replayed=%v, %v)，期望重新执行并成功", result, replayed, err)
+	}
+}
+
+func TestIdempotentExecutorRecoversAfterPanic(t *testing.T) {
+	executor := NewIdempotentExecutor[string](newMemoryStore(), time.Hour)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("operation 的 panic 应该继续往上抛")
+			}
+		}()
+		executor.Do(context.Background(), "pay-4", func(ctx context.Context) (string, error) {
+			panic("数据库驱动崩了")
+		})
+	}()
+
+	// 同一个键不能一直处于"执行中"，也不能把 panic 当成功保存下来
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, replayed, err := executor.Do(ctx, "pay-4", func(ctx context.Context) (string, error) {
+		return "paid", nil
+	})
+	if err != nil || result != "paid" || replayed {
+		t.Errorf("panic 之后 Do = (%q, replayed=%v, %v)，期望重新执行并成功", result, replayed, err)
+	}
+}
+
+func TestIdempotentExecutorWaiterRunsAgainAfterLeaderFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		leader func(ctx context.Context) (string, error)
+	}{
+		{"领头的被取消", func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}},
+		{"领头的遇到临时错误", func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ErrConnectionReset
+		}},
+		{"领头的 panic", func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			panic("数据库驱动崩了")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewIdempotentExecutor[string](newMemoryStore(), time.Hour)
+			leaderCtx, stopLeader := context.WithCancel(context.Background())
+			started := make(chan struct{})
+
+			leaderDone := make(chan struct{})
+			go func() {
+				defer close(leaderDone)
+				defer func() { recover() }()
+				executor.Do(leaderCtx, "pay-5", func(ctx context.Context) (string, error) {
+					close(started)
+					return tt.leader(ctx)
+				})
+			}()
+			<-started
+
+			waiterDone := make(chan struct{})
+			var result string
+			var replayed bool
+			var err error
+			go func() {
+				defer close(waiterDone)
+				result, replayed, err = executor.Do(context.Background(), "pay-5", func(ctx context.Context) (string, error) {
+					return "paid", nil
+				})
+			}()
+
+			time.Sleep(20 * time.Millisecond) // 让等待者先排上队
+			stopLeader()
+			<-leaderDone
+
+			select {
+			case <-waiterDone:
+			case <-time.After(time.Second):
+				t.Fatal("领头的失败之后，等待者一直卡着")
+			}
+			if err != nil || result != "paid" || replayed {
+				t.Errorf("等待者 Do = (%q, replayed=%v, %v)，期望自己重新执行并成功", result, replayed, err)
+			}
+		})
+	}
+}
+
+func TestIdempotentExecutorWithFileStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	operation := func(ctx context.Context) (int, error) { return 42, nil }
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewIdempotentExecutor[int](store, time.Hour).Do(context.Background(), "../order-6", operation)
+
+	// 模拟进程重启：新的存储和执行器，只共享目录
+	restarted, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.OnError = func(err error) { t.Error(err) }
+	result, replayed, err := NewIdempotentExecutor[int](restarted, time.Hour).Do(context.Background(), "../order-6", func(ctx context.Context) (int, error) {
+		t.Error("重启后同一个键不应该再执行")
+		return 0, nil
+	})
+	if err != nil || result != 42 || !replayed {
+		t.Errorf("重启后 Do = (%d, replayed=%v, %v)，期望重放 42", result, replayed, err)
+	}
+}
+
+func TestFileStoreExpiresRecords(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("k", IdempotencyRecord{Value: []byte(`1`)}, 10*time.Millisecond)
+	if _, ok := store.Get("k"); !ok {
+		t.Fatal("刚保存的记录读不到")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := store.Get("k"); ok {
+		t.Error("过期的记录还能读到")
+	}
+}
+
+func TestIdempotentExecutorReplaysStatusErrorFromFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.OnError = func(err error) { t.Error(err) }
+	executor := NewIdempotentExecutor[string](store, time.Hour)
+	operation := func(ctx context.Context) (string, error) {
+		return "", Permanent(&StatusError{StatusCode: http.StatusConflict, Message: "订单已关闭"})
+	}
+
+	executor.Do(context.Background(), "order-7", operation)
+	_, replayed, err := executor.Do(context.Background(), "order-7", operation)
+
+	var status *StatusError
+	if !replayed || !errors.As(err, &status) || status.StatusCode != http.StatusConflict {
+		t.Errorf("从文件重放的错误 = %v (replayed=%v)，期望能取出 409 的 StatusError", err, replayed)
+	}
+}
+
+// racyStore 第一次 Get 返回"没有"之前，先让 beforeMiss 跑完（模拟同键的另一个请求刚好在这时执行完）
+type racyStore struct {
+	*memoryStore
+	fired      atomic.Bool
+	beforeMiss func()
+}
+
+func (s *racyStore) Get(key string) (interface{}, bool) {
+	value, ok := s.memoryStore.Get(key)
+	if !ok && s.fired.CompareAndSwap(false, true) {
+		s.beforeMiss()
+	}
+	return value, ok
+}
+
+func TestIdempotentExecutorRechecksStoreAfterLookupRace(t *testing.T) {
+	store := &racyStore{memoryStore: newMemoryStore()}
+	executor := NewIdempotentExecutor[string](store, time.Hour)
+
+	var executed atomic.Int32
+	operation := func(ctx context.Context) (string, error) {
+		executed.Add(1)
+		return "paid", nil
+	}
+	// 请求 A 查完存储、还没登记"执行中"时，请求 B 完整地执行完并保存了结果
+	store.beforeMiss = func() {
+		executor.Do(context.Background(), "pay-8", operation)
+	}
+
+	result, replayed, err := executor.Do(context.Background(), "pay-8", operation)
+	if err != nil || result != "paid" || !replayed {
+		t.Errorf("Do = (%q, replayed=%v, %v)，期望重放 B 的结果", result, replayed, err)
+	}
+	if got := executed.Load(); got != 1 {
+		t.Errorf("执行了 %d 次，期望只执行 1 次", got)
+	}
+}
+
+// slowStore 每次 Get 都要等一会儿，像是在读远程存储
+type slowStore struct {
+	*memoryStore
+	delay time.Duration
+}
+
+func (s *slowStore) Get(key string) (interface{}, bool) {
+	time.Sleep(s.delay)
+	return s.memoryStore.Get(key)
+}
+
+func TestIdempotentExecutorLooksUpStoreWithoutLock(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	executor := NewIdempotentExecutor[int](&slowStore{memoryStore: newMemoryStore(), delay: delay}, time.Hour)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			executor.Do(context.Background(), fmt.Sprintf("order-%d", i), func(ctx context.Context) (int, error) { return i, nil })
+		}(i)
+	}
+	wg.Wait()
+
+	// 每个请求查两次存储；如果查存储时持有锁，8 个不同的键要排队 800ms
+	if elapsed := time.Since(start); elapsed > 8*delay {
+		t.Errorf("8 个不同的键用了 %v，查存储的时候不应该互相阻塞", elapsed)
+	}
+}
+
+func TestMemoryStoreExpiresRecords(t *testing.T) {
+	store := newMemoryStore()
+	store.Set("short", 1, 10*time.Millisecond)
+	store.Set("forever", 2, 0)
+
+	if _, ok := store.Get("short"); !ok {
+		t.Fatal("刚保存的记录读不到")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := store.Get("short"); ok {
+		t.Error("过期的记录还能读到")
+	}
+	if value, ok := store.Get("forever"); !ok || value != 2 {
+		t.Errorf("ttl 为 0 的记录 = %v, %v，期望永不过期", value, ok)
+	}
+}
+
+func TestIdempotentExecutorRunsAgainAfterTTL(t *testing.T) {
+	executor := NewIdempotentExecutor[int](newMemoryStore(), 10*time.Millisecond)
+	calls := 0
+	operation := func(ctx context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	executor.Do(context.Background(), "order-9", operation)
+	if result, replayed, _ := executor.Do(context.Background(), "order-9", operation); !replayed || result != 1 {
+		t.Fatalf("ttl 之内 Do = (%d, replayed=%v)，期望重放 1", result, replayed)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if result, replayed, _ := executor.Do(context.Background(), "order-9", operation); replayed || result != 2 {
+		t.Errorf("ttl 之后 Do = (%d, replayed=%v)，期望重新执行得到 2", result, replayed)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"time"
@@ -21,22 +23,33 @@ import (
 
 📚 涉及知识点:
 ✓ Select - 超时控制
-✓ Channel - 结果传递
-✓ time.After - 超时检测
+✓ Context - 总超时 / 单次超时 / 外部取消
+✓ 泛型 - Retry[T] 适用于任何返回值类型
 ✓ 循环重试 - 错误处理
 
 🔨 实现思路:
 1. 尝试执行操作
 2. 如果失败，等待一段时间后重试
-3. 如果超过最大重试次数或总超时时间，返回失败
+3. 如果超过最大重试次数或总超时时间（ctx 的 deadline），返回失败
 */
 
 // RetryConfig 重试配置
 type RetryConfig struct {
-	MaxRetries     int           // 最大重试次数
+	MaxRetries     int           // 最多尝试几次（包含第一次调用），小于 1 时按 1 次算
 	InitialBackoff time.Duration // 初始退避时间
-	MaxBackoff     time.Duration // 最大退避时间
+	MaxBackoff     time.Duration // 最大退避时间（0 表示不设上限）
 	Timeout        time.Duration // 总超时时间
+	AttemptTimeout time.Duration // 单次调用的超时时间（0 表示只受总超时限制）
+
+	Strategy BackoffStrategy // 退避策略（零值为不加抖动的指数退避）
+	Rand     *rand.Rand      // 可选：固定种子的随机源，让抖动可复现；不是并发安全的，不要在多个 goroutine 间共享（RetryTransport 会为每个请求单独派生一个）
+
+	Classify Classifier   // 可选：错误分类，nil 时使用 DefaultClassifier
+	RetryOn  []ErrorClass // 可选：只重试这些类别的错误，nil 表示除了 permanent 都重试，空切片表示都不重试
+	Budget   *RetryBudget // 可选：多个调用共享的重试预算，用完后不再重试
+	Hooks    RetryHooks   // 可选：每次尝试、重试、放弃时的回调
+
+	clock retryClock // 取时间、等待、设超时都通过它，nil 时用真实时间；Simulate 换成虚拟时钟
 }
 
 // DefaultRetryConfig 默认配置
@@ -45,24 +58,33 @@ var DefaultRetryConfig = RetryConfig{
 	InitialBackoff: 100 * time.Millisecond,
 	MaxBackoff:     2 * time.Second,
 	Timeout:        10 * time.Second,
+	AttemptTimeout: 5 * time.Second,
 }
 
 // ============================================
 // 模拟不稳定的服务
 // ============================================
 
-// unstableService 模拟一个不稳定的服务
-// 70% 概率失败，30% 概率成功
-func unstableService(requestID int) (string, error) {
-	// 模拟网络延迟
-	delay := time.Duration(50+rand.Intn(200)) * time.Millisecond
-	time.Sleep(delay)
+// unstableFaultConfig unstableService 的故障配置: 70% 返回 503，延迟 50~250ms
+// 种子是固定的，每次运行看到的失败序列都一样；想看别的情况就换一个 Seed
+// 2024 不是为了演示效果挑出来的：场景 2 只有 5 个请求，重试后也可能失败，
+// 重试整体上能把成功率提高多少，看 simulator.go 的策略模拟（成千上万次的统计）
+var unstableFaultConfig = RandomFaultConfig{
+	Seed:        2024,
+	FailureRate: 0.7,
+	Latency:     UniformLatency(50*time.Millisecond, 250*time.Millisecond),
+}
 
-	// 70% 失败率
-	if rand.Float32() < 0.7 {
-		return "", fmt.Errorf("服务暂时不可用")
-	}
+// unstableFaults unstableService 使用的故障模型
+// 可以整个换掉，比如换成 Script(...) 按脚本失败（见 fault_injection.go）
+var unstableFaults FaultModel = NewRandomFaults(unstableFaultConfig)
 
+// unstableService 模拟一个不稳定的服务
+// 70% 概率失败，30% 概率成功；ctx 取消时立即返回
+func unstableService(ctx context.Context, requestID int) (string, error) {
+	if err := unstableFaults.Next().Apply(ctx); err != nil {
+		return "", err
+	}
 	return fmt.Sprintf("请求 %d 成功！数据: {id: %d, status: 'ok'}", requestID, requestID), nil
 }
 
@@ -70,85 +92,184 @@ func unstableService(requestID int) (string, error) {
 // 实现带超时的重试机制
 // ============================================
 
-// RetryWithTimeout 带超时的重试函数
-func RetryWithTimeout(
-	operation func() (string, error), // 要执行的操作
-	config RetryConfig,
-	requestID int,
-) (string, error) {
-	//startTime := time.Now()
-	//backoff := config.InitialBackoff
-
-	// TODO(human): 实现重试逻辑
-	// 你需要实现以下功能：
-	//
-	// 1. 在循环中重试操作（最多 MaxRetries 次）
-	// 2. 每次重试前检查是否已经总超时
-	// 3. 如果操作失败，等待 backoff 时间后重试
-	// 4. 每次重试后，增加 backoff 时间（指数退避）
-	//
-	// 提示代码结构：
-	//
-	// for attempt := 1; attempt <= config.MaxRetries; attempt++ {
-	//     // 检查总超时
-	//     if time.Since(startTime) > config.Timeout {
-	//         return "", fmt.Errorf("总超时 (%v)", config.Timeout)
-	//     }
-	//
-	//     fmt.Printf("  [尝试 %d/%d] 调用服务...\n", attempt, config.MaxRetries)
-	//
-	//     // 使用 channel + select 实现带超时的操作
-	//     resultCh := make(chan string, 1)
-	//     errorCh := make(chan error, 1)
-	//
-	//     go func() {
-	//         result, err := operation()
-	//         if err != nil {
-	//             errorCh <- err
-	//         } else {
-	//             resultCh <- result
-	//         }
-	//     }()
-	//
-	//     // 等待结果或超时
-	//     select {
-	//     case result := <-resultCh:
-	//         // 成功！
-	//         fmt.Printf("  ✅ 成功！(第 %d 次尝试)\n", attempt)
-	//         return result, nil
-	//
-	//     case err := <-errorCh:
-	//         // 失败，准备重试
-	//         fmt.Printf("  ❌ 失败: %v\n", err)
-	//
-	//         if attempt < config.MaxRetries {
-	//             fmt.Printf("  ⏳ 等待 %v 后重试...\n", backoff)
-	//             time.Sleep(backoff)
-	//
-	//             // 指数退避：每次失败后，等待时间翻倍
-	//             backoff *= 2
-	//             if backoff > config.MaxBackoff {
-	//                 backoff = config.MaxBackoff
-	//             }
-	//         }
-	//
-	//     case <-time.After(5 * time.Second):
-	//         // 单次调用超时
-	//         fmt.Printf("  ⏰ 单次调用超时\n")
-	//         if attempt >= config.MaxRetries {
-	//             return "", fmt.Errorf("达到最大重试次数")
-	//         }
-	//     }
-	// }
-	//
-	// return "", fmt.Errorf("达到最大重试次数 (%d)", config.MaxRetries)
-
-	// 你的代码写在这里：
-	// ==================== 开始实现 ====================
-
-	// ==================== 结束实现 ====================
-
-	return "", fmt.Errorf("请实现重试逻辑")
+// Retry 按 config 重试 operation，直到成功、次数用完、遇到永久错误或 ctx 结束
+//
+// 超时都通过 context 传递:
+// - config.Timeout:        整个重试流程的总超时，作为 ctx 的 deadline（ctx 自带更早的 deadline 时以 ctx 为准）
+// - config.AttemptTimeout: 单次调用的超时，operation 收到的 ctx 到点会被取消
+//
+// operation 应该在 ctx 取消后尽快返回；退避等待时 ctx 取消也会立即返回。
+// 失败时返回 *RetryError，里面有每一次尝试的错误。
+func Retry[T any](ctx context.Context, config RetryConfig, operation func(ctx context.Context) (T, error)) (T, error) {
+	result, _, err := RetryWithHistory(ctx, config, operation)
+	return result, err
+}
+
+// RetryWithHistory 同 Retry，另外返回每一次尝试的记录
+func RetryWithHistory[T any](ctx context.Context, config RetryConfig, operation func(ctx context.Context) (T, error)) (T, []AttemptRecord, error) {
+	var zero T
+	clock := config.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	start := clock.Now()
+
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = clock.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	classify := config.Classify
+	if classify == nil {
+		classify = DefaultClassifier
+	}
+
+	// 零值配置也至少调用一次，而不是一次都不调用就报失败
+	maxAttempts := config.MaxRetries
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	backoff := NewBackoff(config)
+	failure := &RetryError{}
+	giveUp := func(reason error) (T, []AttemptRecord, error) {
+		failure.Reason = reason
+		config.Hooks.giveUp(AttemptInfo{
+			Attempt: len(failure.History),
+			Err:     failure,
+			Elapsed: clock.Now().Sub(start),
+		})
+		return zero, failure.History, failure
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		attemptStart := clock.Now()
+		result, err := runAttempt(ctx, clock, config.AttemptTimeout, operation)
+		record := AttemptRecord{Attempt: attempt, Start: attemptStart, Duration: clock.Now().Sub(attemptStart), Err: err}
+		if err != nil {
+			record.Class = classify(err)
+		}
+		config.Hooks.attempt(AttemptInfo{Attempt: attempt, Err: err, Class: record.Class, Elapsed: clock.Now().Sub(start)})
+
+		if err == nil {
+			if config.Budget != nil {
+				config.Budget.Deposit()
+			}
+			return result, append(failure.History, record), nil
+		}
+
+		failure.Attempts = append(failure.Attempts, err)
+		failure.History = append(failure.History, record)
+
+		if ctx.Err() != nil {
+			return giveUp(ctx.Err())
+		}
+		if !config.retryable(record.Class) || attempt == maxAttempts {
+			return giveUp(nil)
+		}
+
+		delay := nextDelay(backoff, err)
+
+		// 等不到下一次重试就会总超时，没必要再等
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(clock.Now()) < delay {
+			return giveUp(context.DeadlineExceeded)
+		}
+
+		// 真正要重试了才花预算
+		if config.Budget != nil && !config.Budget.TryWithdraw() {
+			return giveUp(ErrRetryBudgetExhausted)
+		}
+
+		failure.History[len(failure.History)-1].Delay = delay
+		config.Hooks.retry(AttemptInfo{Attempt: attempt, Err: err, Class: record.Class, Delay: delay, Elapsed: clock.Now().Sub(start)})
+		if err := clock.Sleep(ctx, delay); err != nil {
+			return giveUp(err)
+		}
+	}
+
+	return giveUp(nil)
+}
+
+// nextDelay 计算下一次重试前的等待时间：服务端要求的等待时间优先于退避策略
+func nextDelay(backoff *Backoff, err error) time.Duration {
+	delay := backoff.Next()
+	if retryAfter, ok := RetryAfterDelay(err); ok && retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// retryable 判断某一类错误要不要重试
+func (c RetryConfig) retryable(class ErrorClass) bool {
+	if class == ClassPermanent {
+		return false
+	}
+	if c.RetryOn == nil {
+		return true
+	}
+	for _, allowed := range c.RetryOn {
+		if class == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// runAttempt 执行一次调用，timeout > 0 时给这次调用单独设置超时
+//
+// 调用在当前 goroutine 里同步执行，不会另开 goroutine 再用 select 等它：
+// 超时只是取消 ctx，要等 operation 真正返回才开始下一次尝试。
+// 所以同一时刻最多只有一次尝试在执行，也不会有被丢下还在跑的 goroutine。
+// 代价是：不理会 ctx 的 operation 会让单次超时失效——这是 operation 的 bug，要修的是它。
+func runAttempt[T any](ctx context.Context, clock retryClock, timeout time.Duration, operation func(ctx context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return operation(ctx)
+	}
+
+	attemptCtx, cancel := clock.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := operation(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		// 是单次超时而不是总超时，标记出来方便分类
+		err = fmt.Errorf("%w (%v): %w", ErrAttemptTimeout, timeout, err)
+	}
+	return result, err
+}
+
+// retryClock RetryWithHistory 用到的所有时间操作
+// 平时是 realClock；Simulate 换成 virtualClock，同一套重试逻辑就能在虚拟时间上跑
+type retryClock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error // 等待 d，ctx 结束时提前返回 ctx.Err()
+	WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc)
+}
+
+// realClock 真实时间
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error { return sleepContext(ctx, d) }
+
+func (realClock) WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d)
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回 ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func mainT() {
@@ -162,7 +283,7 @@ func mainT() {
 
 	successCount := 0
 	for i := 1; i <= 10; i++ {
-		result, err := unstableService(i)
+		result, err := unstableService(context.Background(), i)
 		if err != nil {
 			fmt.Printf("请求 %d: ❌ %v\n", i, err)
 		} else {
@@ -184,6 +305,9 @@ func mainT() {
 		InitialBackoff: 100 * time.Millisecond,
 		MaxBackoff:     1 * time.Second,
 		Timeout:        10 * time.Second,
+		AttemptTimeout: 200 * time.Millisecond, // 比最慢的响应（250ms）短，部分慢请求会被超时重试
+		Strategy:       BackoffFullJitter,
+		Hooks:          narrateHooks(3),
 	}
 
 	successCount = 0
@@ -193,13 +317,9 @@ func mainT() {
 		fmt.Printf("\n🔄 请求 %d:\n", i)
 		start := time.Now()
 
-		result, err := RetryWithTimeout(
-			func() (string, error) {
-				return unstableService(i)
-			},
-			config,
-			i,
-		)
+		result, err := Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+			return unstableService(ctx, i)
+		})
 
 		duration := time.Since(start)
 		totalDuration += duration
@@ -216,6 +336,7 @@ func mainT() {
 	fmt.Println("📊 统计:")
 	fmt.Printf("  成功率: %d/5 (%.0f%%)\n", successCount, float64(successCount)*20)
 	fmt.Printf("  平均耗时: %v\n", totalDuration/5)
+	fmt.Println("  （只有 5 个样本，重试的整体效果见后面的策略模拟）")
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Println()
 
@@ -236,11 +357,31 @@ func mainT() {
 		}
 	}
 
+	fmt.Println()
+	backoffStrategiesDemo()
+
+	// 进阶: 其它文件里的重试工具，按从简单到复杂的顺序演示
+	for _, demo := range []func(){
+		errorClassificationDemo, // retry_errors.go
+		attemptLeakDemo,         // attempt_leak.go
+		circuitBreakerDemo,      // circuit_breaker.go
+		retryBudgetDemo,         // retry_budget.go
+		hedgeDemo,               // hedge.go
+		retryHooksDemo,          // retry_hooks.go
+		retryPolicyDemo,         // retry_policy.go
+		faultInjectionDemo,      // fault_injection.go
+		simulatorDemo,           // simulator.go
+		idempotencyDemo,         // idempotency.go
+	} {
+		fmt.Println()
+		demo()
+	}
 	fmt.Println("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Println("💡 总结:")
 	fmt.Println("  • 重试可以大幅提高成功率（30% -> 90%+）")
 	fmt.Println("  • 指数退避避免对服务造成压力")
 	fmt.Println("  • 超时控制防止无限等待")
+	fmt.Println("  • 抖动把重试打散，避免所有客户端同时重试（见 backoff.go）")
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
 	// 💡 思考题:
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+💰 重试预算 (Retry Budget)
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+MaxRetries = 3 看起来很克制，可下游一挂，每个请求都重试满 3 次，
+整个集群打过去的流量就是平时的 3 倍 —— 恰好在下游最脆弱的时候。
+
+重试预算换了个思路：不限制"每个请求能重试几次"，而是限制"重试占总流量的比例"。
+- 本质是一个令牌桶，每次重试要花 1 个令牌
+- 每成功一个请求，存入 ratio 个令牌（比如 0.1 → 重试最多占成功请求的 10%）
+- 另外每秒固定补充一点，保证流量很小的时候也能重试
+- 令牌花光了就不再重试，直接返回失败
+
+下游健康时成功多，令牌充足，偶尔的失败照常重试；
+下游挂了没有成功，令牌很快花光，额外流量被限制在很小的范围内。
+
+💡 多个 Retry 共享同一个 RetryBudget（比如一个下游服务一个），才能起到限制整体的作用。
+*/
+
+// ErrRetryBudgetExhausted 重试预算用完了
+var ErrRetryBudgetExhausted = errors.New("重试预算已用完")
+
+// RetryBudget 重试预算，可以被多个 goroutine 共享
+type RetryBudget struct {
+	ratio        float64          // 每个成功请求存入多少令牌
+	minPerSecond float64          // 每秒固定补充多少令牌
+	maxTokens    float64          // 最多存多少令牌
+	now          func() time.Time // 当前时间，测试里可以换成虚拟时钟
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRetryBudget 创建重试预算
+// ratio: 重试次数最多占成功请求的比例，比如 0.1
+// minPerSecond: 不管成功多少，每秒至少允许多少次重试
+// maxTokens: 最多攒多少次重试，也是初始值
+func NewRetryBudget(ratio float64, minPerSecond float64, maxTokens float64) *RetryBudget {
+	return &RetryBudget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		maxTokens:    maxTokens,
+		tokens:       maxTokens,
+		now:          time.Now,
+		last:         time.Now(),
+	}
+}
+
+// Deposit 记录一次成功的请求，存入 ratio 个令牌
+func (b *RetryBudget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.now())
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// TryWithdraw 申请一次重试，预算不够时返回 false
+func (b *RetryBudget) TryWithdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Available 返回当前还能重试几次
+func (b *RetryBudget) Available() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.now())
+	return b.tokens
+}
+
+// refill 按经过的时间补充固定部分的令牌（调用方需持有锁）
+func (b *RetryBudget) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.last = now
+	b.tokens += elapsed.Seconds() * b.minPerSecond
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// ============================================
+// 演示: 下游挂掉时，集群的额外流量有多少
+// ============================================
+
+func retryBudgetDemo() {
+	fmt.Println("📍 重试预算演示: 下游完全不可用，50 个请求，每个最多尝试 3 次")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	run := func(budget *RetryBudget) int {
+		calls := 0
+		config := RetryConfig{
+			MaxRetries:     3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+			Timeout:        time.Second,
+			Budget:         budget,
+		}
+		for i := 0; i < 50; i++ {
+			Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+				calls++
+				return "", &StatusError{StatusCode: 503, Message: "服务挂了"}
+			})
+		}
+		return calls
+	}
+
+	without := run(nil)
+	budget := NewRetryBudget(0.1, 1, 10)
+	with := run(budget)
+
+	fmt.Printf("  没有预算: 下游收到 %d 次调用（放大 %.1f 倍）\n", without, float64(without)/50)
+	fmt.Printf("  有预算:   下游收到 %d 次调用（放大 %.1f 倍），剩余预算 %.1f\n",
+		with, float64(with)/50, budget.Available())
+}
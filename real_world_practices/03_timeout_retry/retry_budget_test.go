@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newVirtualBudget 创建按虚拟时钟补充令牌的重试预算
+func newVirtualBudget(clock *virtualClock, ratio, minPerSecond, maxTokens float64) *RetryBudget {
+	budget := NewRetryBudget(ratio, minPerSecond, maxTokens)
+	budget.now = clock.Now
+	budget.last = clock.Now()
+	return budget
+}
+
+func TestRetryBudgetDepositAndWithdraw(t *testing.T) {
+	clock := &virtualClock{now: time.Unix(0, 0)}
+	budget := newVirtualBudget(clock, 0.5, 0, 2)
+
+	// 初始是满的
+	for i := 0; i < 2; i++ {
+		if !budget.TryWithdraw() {
+			t.Fatalf("第 %d 次 TryWithdraw 失败，初始应该有 2 次", i+1)
+		}
+	}
+	if budget.TryWithdraw() {
+		t.Fatal("预算花光了，TryWithdraw 应该返回 false")
+	}
+
+	// 成功一次存 0.5，不够重试一次
+	budget.Deposit()
+	if budget.TryWithdraw() {
+		t.Error("只存了 0.5 个令牌，不够重试一次")
+	}
+	budget.Deposit()
+	if !budget.TryWithdraw() {
+		t.Error("存够 1 个令牌后应该可以重试")
+	}
+
+	// 最多存 maxTokens
+	for i := 0; i < 10; i++ {
+		budget.Deposit()
+	}
+	if got := budget.Available(); got != 2 {
+		t.Errorf("Available() = %v，期望封顶 2", got)
+	}
+}
+
+func TestRetryBudgetRefill(t *testing.T) {
+	clock := &virtualClock{now: time.Unix(0, 0)}
+	budget := newVirtualBudget(clock, 0, 2, 3)
+	for budget.TryWithdraw() {
+	}
+
+	tests := []struct {
+		advance time.Duration
+		want    float64
+	}{
+		{250 * time.Millisecond, 0.5},
+		{250 * time.Millisecond, 1},
+		{10 * time.Second, 3}, // 封顶
+	}
+	for _, tt := range tests {
+		clock.now = clock.now.Add(tt.advance)
+		if got := budget.Available(); got != tt.want {
+			t.Errorf("再过 %v 后 Available() = %v，期望 %v", tt.advance, got, tt.want)
+		}
+	}
+
+	// 时钟回拨不扣令牌
+	clock.now = clock.now.Add(-time.Hour)
+	if got := budget.Available(); got != 3 {
+		t.Errorf("时钟回拨后 Available() = %v，期望 3", got)
+	}
+}
+
+func TestRetryFailsFastWhenBudgetExhausted(t *testing.T) {
+	clock := &virtualClock{now: time.Unix(0, 0)}
+	budget := newVirtualBudget(clock, 0.1, 1, 2)
+	config := RetryConfig{
+		MaxRetries:     5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+		Budget:         budget,
+		clock:          clock,
+	}
+
+	calls := 0
+	unavailable := func(ctx context.Context) (string, error) {
+		calls++
+		return "", &StatusError{StatusCode: 503, Message: "服务挂了"}
+	}
+
+	// 第一次: 预算只够重试 2 次（等待的 200ms 里只补回 0.2 个令牌）
+	_, history, err := RetryWithHistory(context.Background(), config, unavailable)
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("err = %v，期望 ErrRetryBudgetExhausted", err)
+	}
+	if calls != 3 || len(history) != 3 {
+		t.Fatalf("调用了 %d 次（记录 %d 条），期望 1 次 + 2 次重试", calls, len(history))
+	}
+	if last := history[len(history)-1]; last.Delay != 0 {
+		t.Errorf("预算用完后不应该再等待，最后一次的 Delay = %v", last.Delay)
+	}
+
+	// 第二次: 预算已经花光，立即失败，不再等待
+	calls = 0
+	start := clock.Now()
+	_, err = Retry(context.Background(), config, unavailable)
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("err = %v，期望 ErrRetryBudgetExhausted", err)
+	}
+	if calls != 1 {
+		t.Errorf("预算花光后调用了 %d 次，期望只调用 1 次", calls)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 0 {
+		t.Errorf("预算花光后还等了 %v", elapsed)
+	}
+
+	// 过一会儿按 minPerSecond 补充了令牌，又可以重试了
+	clock.now = clock.now.Add(time.Second)
+	calls = 0
+	Retry(context.Background(), config, unavailable)
+	if calls != 2 {
+		t.Errorf("补充 1 个令牌后调用了 %d 次，期望 2 次", calls)
+	}
+}
+
+func TestRetryDepositsOnSuccess(t *testing.T) {
+	clock := &virtualClock{now: time.Unix(0, 0)}
+	budget := newVirtualBudget(clock, 0.5, 0, 10)
+	for budget.TryWithdraw() {
+	}
+
+	config := RetryConfig{MaxRetries: 3, InitialBackoff: time.Millisecond, Budget: budget, clock: clock}
+	for i := 0; i < 4; i++ {
+		if _, err := Retry(context.Background(), config, func(ctx context.Context) (int, error) { return 1, nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := budget.Available(); got != 2 {
+		t.Errorf("成功 4 次后 Available() = %v，期望 2", got)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+🚦 哪些错误值得重试？
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+思考题 4 的答案：不是所有错误都该重试。
+- 4xx（参数错误、没权限、资源不存在）: 再试 100 次也一样，立即放弃
+- 5xx（服务暂时不可用）、超时:          过一会儿可能就好了，值得重试
+- 429 / 503 带 Retry-After:             服务端告诉你要等多久，按它说的等
+
+🔨 实现思路:
+1. Classifier 把错误分成几类，Permanent 类立即停止重试
+2. 调用方可以用 Permanent(err) 明确标记"别重试了"
+3. 用 RetryAfter(err, d) 带上服务端要求的等待时间
+4. 最终返回的 *RetryError 包含每一次尝试的错误，errors.Is / errors.As 都能找到它们
+*/
+
+// ErrAttemptTimeout 单次调用超过了 AttemptTimeout
+var ErrAttemptTimeout = errors.New("单次调用超时")
+
+// ErrorClass 错误的分类
+type ErrorClass string
+
+const (
+	ClassTransient ErrorClass = "transient" // 临时错误（5xx、连接断开等），可以重试
+	ClassTimeout   ErrorClass = "timeout"   // 单次调用超时，可以重试
+	ClassThrottled ErrorClass = "throttled" // 被限流（429、带 Retry-After），等一会儿再重试
+	ClassPermanent ErrorClass = "permanent" // 永久错误（4xx、参数错误），不要重试
+)
+
+// Classifier 判断一个错误属于哪一类
+type Classifier func(err error) ErrorClass
+
+// DefaultClassifier 默认的分类规则:
+// Permanent(err) → permanent，RetryAfter(err, d) → throttled，
+// *StatusError 按状态码分类，超时 → timeout，其它 → transient
+func DefaultClassifier(err error) ErrorClass {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return ClassPermanent
+	}
+	if _, ok := RetryAfterDelay(err); ok {
+		return ClassThrottled
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Class()
+	}
+	if errors.Is(err, ErrAttemptTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return ClassTimeout
+	}
+	return ClassTransient
+}
+
+// ============================================
+// 标记错误的辅助函数
+// ============================================
+
+// permanentError 不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 把 err 标记为不可重试，Retry 遇到它会立即停止
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// retryAfterError 带服务端指定等待时间的错误
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// RetryAfter 给 err 附上服务端要求的等待时间（比如 Retry-After 头）
+// 下一次重试至少等待 d，即使退避策略算出的时间更短
+func RetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, delay: d}
+}
+
+// RetryAfterDelay 取出 RetryAfter 附加的等待时间
+func RetryAfterDelay(err error) (time.Duration, bool) {
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) {
+		return retryAfter.delay, true
+	}
+	return 0, false
+}
+
+// StatusError 带 HTTP 状态码的错误
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Class 按状态码分类: 408 超时，429 限流，其它 4xx 永久，5xx 临时
+func (e *StatusError) Class() ErrorClass {
+	switch {
+	case e.StatusCode == 408:
+		return ClassTimeout
+	case e.StatusCode == 429:
+		return ClassThrottled
+	case e.StatusCode >= 400 && e.StatusCode < 500:
+		return ClassPermanent
+	default:
+		return ClassTransient
+	}
+}
+
+// ============================================
+// 最终错误
+// ============================================
+
+// RetryError 重试最终失败时返回的错误，包含每一次尝试的错误
+type RetryError struct {
+	Attempts []error // 每一次尝试的错误，按顺序
+	Reason   error   // 放弃的原因: ctx.Err()，或者 nil（次数用完 / 遇到永久错误）
+
+	History []AttemptRecord // 每一次尝试的详细记录
+}
+
+// Error 返回放弃原因和最后一次的错误
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "尝试 %d 次后失败", len(e.Attempts))
+	if e.Reason != nil {
+		fmt.Fprintf(&b, " (%v)", e.Reason)
+	}
+	if last := e.Last(); last != nil {
+		fmt.Fprintf(&b, ": %v", last)
+	}
+	return b.String()
+}
+
+// Last 返回最后一次尝试的错误
+func (e *RetryError) Last() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// Unwrap 让 errors.Is / errors.As 能找到放弃原因和每一次尝试的错误
+func (e *RetryError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Attempts)+1)
+	if e.Reason != nil {
+		errs = append(errs, e.Reason)
+	}
+	return append(errs, e.Attempts...)
+}
+
+// ============================================
+// 演示: 4xx 立即放弃，429 按服务端要求等待
+// ============================================
+
+func errorClassificationDemo() {
+	fmt.Println("📍 错误分类演示")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	config := RetryConfig{
+		MaxRetries:     5,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Timeout:        5 * time.Second,
+		Hooks:          narrateHooks(5),
+	}
+
+	// 场景 1: 404 不会重试
+	fmt.Println("🔄 请求一个不存在的资源:")
+	_, err := Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+		return "", &StatusError{StatusCode: 404, Message: "订单不存在"}
+	})
+	var status *StatusError
+	if errors.As(err, &status) {
+		fmt.Printf("  最终错误: %v（状态码 %d，没有重试）\n", err, status.StatusCode)
+	}
+
+	// 场景 2: 第一次 429 要求等 300ms，第二次成功
+	fmt.Println("🔄 被限流后按 Retry-After 等待:")
+	calls := 0
+	start := time.Now()
+	result, err := Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", RetryAfter(&StatusError{StatusCode: 429, Message: "请求太频繁"}, 300*time.Millisecond)
+		}
+		return "ok", nil
+	})
+	fmt.Printf("  结果: %q, 错误: %v, 耗时 %v（退避只要 50ms，但服务端要求 300ms）\n",
+		result, err, time.Since(start).Round(10*time.Millisecond))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatusErrorClass(t *testing.T) {
+	tests := []struct {
+		code int
+		want ErrorClass
+	}{
+		{400, ClassPermanent},
+		{401, ClassPermanent},
+		{404, ClassPermanent},
+		{408, ClassTimeout},
+		{422, ClassPermanent},
+		{429, ClassThrottled},
+		{499, ClassPermanent},
+		{500, ClassTransient},
+		{502, ClassTransient},
+		{503, ClassTransient},
+		{504, ClassTransient},
+	}
+	for _, tt := range tests {
+		err := &StatusError{StatusCode: tt.code, Message: "test"}
+		if got := err.Class(); got != tt.want {
+			t.Errorf("StatusError{%d}.Class() = %q，期望 %q", tt.code, got, tt.want)
+		}
+		// 包了一层也要按状态码分类
+		if got := DefaultClassifier(errors.Join(errors.New("请求失败"), err)); got != tt.want {
+			t.Errorf("DefaultClassifier(包装的 %d) = %q，期望 %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"普通错误", errors.New("连接被重置"), ClassTransient},
+		{"单次超时", ErrAttemptTimeout, ClassTimeout},
+		{"ctx 超时", context.DeadlineExceeded, ClassTimeout},
+		{"Permanent 优先于状态码", Permanent(&StatusError{StatusCode: 503}), ClassPermanent},
+		{"RetryAfter 优先于状态码", RetryAfter(&StatusError{StatusCode: 503}, time.Second), ClassThrottled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultClassifier(tt.err); got != tt.want {
+				t.Errorf("DefaultClassifier(%v) = %q，期望 %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryWaitsAtLeastRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		backoff    time.Duration
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{"服务端要求的更长", 50 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+		{"退避算出的更长", 500 * time.Millisecond, 300 * time.Millisecond, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock := &virtualClock{now: start}
+			config := RetryConfig{
+				MaxRetries:     3,
+				InitialBackoff: tt.backoff,
+				MaxBackoff:     time.Second,
+				Timeout:        10 * time.Second,
+				clock:          clock,
+			}
+
+			var calledAt []time.Time
+			_, history, err := RetryWithHistory(context.Background(), config, func(ctx context.Context) (string, error) {
+				calledAt = append(calledAt, clock.Now())
+				if len(calledAt) == 1 {
+					return "", RetryAfter(&StatusError{StatusCode: 429, Message: "请求太频繁"}, tt.retryAfter)
+				}
+				return "ok", nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(calledAt) != 2 {
+				t.Fatalf("调用了 %d 次，期望 2 次", len(calledAt))
+			}
+			if waited := calledAt[1].Sub(calledAt[0]); waited != tt.want {
+				t.Errorf("两次调用间隔 %v，期望 %v", waited, tt.want)
+			}
+			if history[0].Class != ClassThrottled || history[0].Delay != tt.want {
+				t.Errorf("第一次的记录 = %+v，期望 throttled 并等待 %v", history[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryErrorUnwrapFindsEveryAttempt(t *testing.T) {
+	errReset := errors.New("连接被重置")
+	attempts := []error{
+		errReset,
+		&StatusError{StatusCode: 503, Message: "维护中"},
+		RetryAfter(&StatusError{StatusCode: 429, Message: "请求太频繁"}, time.Millisecond),
+	}
+
+	calls := 0
+	_, err := Retry(context.Background(), RetryConfig{MaxRetries: len(attempts), InitialBackoff: time.Millisecond},
+		func(ctx context.Context) (string, error) {
+			calls++
+			return "", attempts[calls-1]
+		})
+
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("返回的错误 %T 不是 *RetryError", err)
+	}
+	if len(retryErr.Attempts) != len(attempts) || retryErr.Last() != attempts[len(attempts)-1] {
+		t.Fatalf("Attempts = %v，期望 %v", retryErr.Attempts, attempts)
+	}
+
+	// 第一次尝试的错误也能用 errors.Is 找到，不只是最后一次
+	if !errors.Is(err, errReset) {
+		t.Error("errors.Is 找不到第一次尝试的错误")
+	}
+
+	// errors.As 按顺序找，第一个 StatusError 是 503
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != 503 {
+		t.Errorf("errors.As 找到的 StatusError = %v，期望 503", status)
+	}
+
+	// 每一次的错误都能在 Unwrap 的结果里找到
+	for i, attempt := range attempts {
+		found := false
+		for _, wrapped := range retryErr.Unwrap() {
+			if wrapped == attempt {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Unwrap() 里没有第 %d 次尝试的错误 %v", i+1, attempt)
+		}
+	}
+	if d, ok := RetryAfterDelay(err); !ok || d != time.Millisecond {
+		t.Errorf("RetryAfterDelay(err) = %v, %v，期望找到最后一次的 1ms", d, ok)
+	}
+}
+
+func TestRetryErrorUnwrapIncludesReason(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := Retry(ctx, RetryConfig{MaxRetries: 5, InitialBackoff: time.Millisecond},
+		func(ctx context.Context) (string, error) {
+			cancel()
+			return "", errors.New("失败")
+		})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("errors.Is(err, context.Canceled) = false，err = %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+/*
+🔭 可观测的重试: 钩子与尝试记录
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+Retry 自己往终端 fmt.Printf，放进库里就没法用了：
+日志格式对不上、没法按级别过滤、也没法统计"平均每个请求重试几次"。
+
+现在 Retry 本身不打印任何东西，而是:
+1. 在关键时刻调用钩子，由调用方决定怎么处理
+   - OnAttempt: 每次尝试结束后（成功或失败）
+   - OnRetry:   决定重试、开始等待之前
+   - OnGiveUp:  最终放弃时
+2. 记录每一次尝试（RetryWithHistory 返回），可以整体写日志或导出指标
+
+SlogHooks 把钩子接到 log/slog；narrateHooks 是演示用的中文旁白。
+*/
+
+// AttemptInfo 传给钩子的信息
+type AttemptInfo struct {
+	Attempt int           // 第几次尝试，从 1 开始
+	Err     error         // 这次尝试的错误（OnGiveUp 时为最终的 *RetryError）
+	Class   ErrorClass    // OnAttempt / OnRetry: 按 RetryConfig.Classify 分出的类别，成功时为空
+	Delay   time.Duration // OnRetry: 下一次重试前要等多久
+	Elapsed time.Duration // 从 Retry 开始到现在经过的时间
+}
+
+// RetryHooks 重试过程中的钩子，都是可选的，在调用 Retry 的 goroutine 里同步执行
+type RetryHooks struct {
+	OnAttempt func(info AttemptInfo)
+	OnRetry   func(info AttemptInfo)
+	OnGiveUp  func(info AttemptInfo)
+}
+
+// AttemptRecord 一次尝试的记录
+type AttemptRecord struct {
+	Attempt  int
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+	Class    ErrorClass    // Err 为 nil 时为空
+	Delay    time.Duration // 这次失败后等待了多久才重试（没有重试时为 0）
+}
+
+// LogValue 实现 slog.LogValuer
+func (r AttemptRecord) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Int("attempt", r.Attempt),
+		slog.Duration("duration", r.Duration),
+	}
+	if r.Err != nil {
+		attrs = append(attrs, slog.String("error", r.Err.Error()), slog.String("class", string(r.Class)))
+	}
+	if r.Delay > 0 {
+		attrs = append(attrs, slog.Duration("delay", r.Delay))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// attempt 调用 OnAttempt 钩子
+func (h RetryHooks) attempt(info AttemptInfo) {
+	if h.OnAttempt != nil {
+		h.OnAttempt(info)
+	}
+}
+
+// retry 调用 OnRetry 钩子
+func (h RetryHooks) retry(info AttemptInfo) {
+	if h.OnRetry != nil {
+		h.OnRetry(info)
+	}
+}
+
+// giveUp 调用 OnGiveUp 钩子
+func (h RetryHooks) giveUp(info AttemptInfo) {
+	if h.OnGiveUp != nil {
+		h.OnGiveUp(info)
+	}
+}
+
+// SlogHooks 把重试过程写入 logger：失败的尝试和重试为 Debug，放弃为 Warn
+func SlogHooks(logger *slog.Logger) RetryHooks {
+	return RetryHooks{
+		OnAttempt: func(info AttemptInfo) {
+			if info.Err != nil {
+				logger.Debug("尝试失败", "attempt", info.Attempt, "error", info.Err, "class", info.Class, "elapsed", info.Elapsed)
+			}
+		},
+		OnRetry: func(info AttemptInfo) {
+			logger.Debug("准备重试", "attempt", info.Attempt, "delay", info.Delay, "elapsed", info.Elapsed)
+		},
+		OnGiveUp: func(info AttemptInfo) {
+			logger.Warn("放弃重试", "attempts", info.Attempt, "error", info.Err, "elapsed", info.Elapsed)
+		},
+	}
+}
+
+// LogHistory 把一次 Retry 的全部尝试记录写成一条日志
+func LogHistory(ctx context.Context, logger *slog.Logger, msg string, history []AttemptRecord, err error) {
+	attrs := make([]any, 0, len(history)+2)
+	attrs = append(attrs, slog.Int("attempts", len(history)))
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	for _, record := range history {
+		attrs = append(attrs, slog.Any(fmt.Sprintf("attempt_%d", record.Attempt), record))
+	}
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	logger.Log(ctx, level, msg, attrs...)
+}
+
+// narrateHooks 演示用：像原来一样用中文旁白打印每一次尝试
+func narrateHooks(maxAttempts int) RetryHooks {
+	return RetryHooks{
+		OnAttempt: func(info AttemptInfo) {
+			if info.Err == nil {
+				fmt.Printf("  ✅ 成功！(第 %d/%d 次尝试)\n", info.Attempt, maxAttempts)
+			} else {
+				fmt.Printf("  ❌ 第 %d/%d 次尝试失败 (%s): %v\n",
+					info.Attempt, maxAttempts, info.Class, info.Err)
+			}
+		},
+		OnRetry: func(info AttemptInfo) {
+			fmt.Printf("  ⏳ 等待 %v 后重试...\n", info.Delay.Round(time.Millisecond))
+		},
+	}
+}
+
+// ============================================
+// 演示: 用 slog 记录重试过程
+// ============================================
+
+func retryHooksDemo() {
+	fmt.Println("📍 重试钩子演示: 用 slog 输出结构化日志")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	config := RetryConfig{
+		MaxRetries:     4,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     200 * time.Millisecond,
+		Timeout:        5 * time.Second,
+		Strategy:       BackoffEqualJitter,
+		Hooks:          SlogHooks(logger),
+	}
+
+	calls := 0
+	_, history, err := RetryWithHistory(context.Background(), config, func(ctx context.Context) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", &StatusError{StatusCode: 503, Message: "服务暂时不可用"}
+		}
+		return "ok", nil
+	})
+	LogHistory(context.Background(), logger, "请求完成", history, err)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// hookRecorder 按顺序记下每一次钩子调用
+type hookRecorder struct {
+	calls []string
+	infos []AttemptInfo
+}
+
+func (r *hookRecorder) hooks() RetryHooks {
+	record := func(name string) func(AttemptInfo) {
+		return func(info AttemptInfo) {
+			r.calls = append(r.calls, fmt.Sprintf("%s %d", name, info.Attempt))
+			r.infos = append(r.infos, info)
+		}
+	}
+	return RetryHooks{OnAttempt: record("attempt"), OnRetry: record("retry"), OnGiveUp: record("giveUp")}
+}
+
+func TestRetryHooksOrderAndInfo(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := &virtualClock{now: start}
+	recorder := &hookRecorder{}
+	config := RetryConfig{
+		MaxRetries:     3,
+		InitialBackoff: 100 * time.Millisecond,
+		Strategy:       BackoffConstant,
+		Hooks:          recorder.hooks(),
+		clock:          clock,
+	}
+
+	calls := 0
+	_, history, err := RetryWithHistory(context.Background(), config, func(ctx context.Context) (string, error) {
+		calls++
+		clock.Sleep(ctx, 10*time.Millisecond) // 每次调用花 10ms
+		if calls < 3 {
+			return "", &StatusError{StatusCode: 503, Message: "维护中"}
+		}
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := []string{"attempt 1", "retry 1", "attempt 2", "retry 2", "attempt 3"}
+	if fmt.Sprint(recorder.calls) != fmt.Sprint(wantCalls) {
+		t.Fatalf("钩子调用顺序 = %v，期望 %v", recorder.calls, wantCalls)
+	}
+
+	// 每次调用 10ms + 每次重试等 100ms
+	wantInfos := []struct {
+		class   ErrorClass
+		delay   time.Duration
+		elapsed time.Duration
+		failed  bool
+	}{
+		{ClassTransient, 0, 10 * time.Millisecond, true},
+		{ClassTransient, 100 * time.Millisecond, 10 * time.Millisecond, true},
+		{ClassTransient, 0, 120 * time.Millisecond, true},
+		{ClassTransient, 100 * time.Millisecond, 120 * time.Millisecond, true},
+		{"", 0, 230 * time.Millisecond, false},
+	}
+	for i, want := range wantInfos {
+		info := recorder.infos[i]
+		if info.Class != want.class || info.Delay != want.delay || info.Elapsed != want.elapsed || (info.Err != nil) != want.failed {
+			t.Errorf("%s 的 AttemptInfo = %+v，期望 Class=%q Delay=%v Elapsed=%v 失败=%v",
+				recorder.calls[i], info, want.class, want.delay, want.elapsed, want.failed)
+		}
+	}
+
+	// 尝试记录和钩子看到的一致
+	if len(history) != 3 {
+		t.Fatalf("记录了 %d 次尝试，期望 3 次", len(history))
+	}
+	for i, record := range history {
+		wantStart := start.Add(time.Duration(i) * 110 * time.Millisecond)
+		if record.Attempt != i+1 || !record.Start.Equal(wantStart) || record.Duration != 10*time.Millisecond {
+			t.Errorf("第 %d 条记录 = %+v，期望 Start=%v Duration=10ms", i+1, record, wantStart)
+		}
+	}
+	if history[0].Delay != 100*time.Millisecond || history[2].Delay != 0 || history[2].Class != "" {
+		t.Errorf("记录的 Delay / Class 不对: %+v", history)
+	}
+}
+
+func TestRetryHooksGiveUp(t *testing.T) {
+	recorder := &hookRecorder{}
+	config := RetryConfig{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		Hooks:          recorder.hooks(),
+		clock:          &virtualClock{now: time.Unix(0, 0)},
+	}
+	_, err := Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+		return "", errors.New("连接被重置")
+	})
+
+	wantCalls := []string{"attempt 1", "retry 1", "attempt 2", "giveUp 2"}
+	if fmt.Sprint(recorder.calls) != fmt.Sprint(wantCalls) {
+		t.Fatalf("钩子调用顺序 = %v，期望 %v", recorder.calls, wantCalls)
+	}
+	last := recorder.infos[len(recorder.infos)-1]
+	var retryErr *RetryError
+	if !errors.As(last.Err, &retryErr) || last.Err != err {
+		t.Errorf("OnGiveUp 的 Err = %v，期望 Retry 返回的 *RetryError", last.Err)
+	}
+}
+
+func TestRetryHooksUseConfiguredClassifier(t *testing.T) {
+	recorder := &hookRecorder{}
+	config := RetryConfig{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		Hooks:          recorder.hooks(),
+		clock:          &virtualClock{now: time.Unix(0, 0)},
+		Classify:       func(err error) ErrorClass { return ClassThrottled },
+	}
+	Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+		return "", &StatusError{StatusCode: 503, Message: "维护中"} // 默认会分成 transient
+	})
+
+	for i, info := range recorder.infos[:2] {
+		if info.Class != ClassThrottled {
+			t.Errorf("%s 的 Class = %q，期望配置的分类 throttled", recorder.calls[i], info.Class)
+		}
+	}
+}
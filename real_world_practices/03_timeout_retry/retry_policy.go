@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/*
+📜 从配置文件加载重试策略
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+每个团队都在代码里手写一份 RetryConfig{...}，改个超时就要发版，
+还经常写出自相矛盾的配置：初始退避 5s、最大退避 1s；总超时 100ms、第一次退避就要 200ms。
+
+改成在配置文件里定义一组有名字的策略，运行时按名字取:
+
+{
+    "policies": {
+        "payment": {
+            "max_attempts": 3,
+            "backoff": "equal-jitter",
+            "initial_backoff": "200ms",
+            "max_backoff": "2s",
+            "timeout": "10s",
+            "attempt_timeout": "3s",
+            "retry_on": ["transient", "timeout"]
+        }
+    }
+}
+
+- backoff:  constant / linear / exponential / full-jitter / equal-jitter / decorrelated-jitter
+- retry_on: transient / timeout / throttled，不写表示除了 permanent 都重试，写成 [] 表示什么都不重试
+- 时间用 Go 的写法: "100ms"、"2s"、"1m"
+
+加载时就做完整校验，所有问题一次列出来，不会等到半夜出故障才发现配置写错了。
+
+⚠️ 只支持 JSON：标准库没有 YAML 解析器，这个仓库不引入第三方依赖。
+*/
+
+// ErrUnknownPolicy 没有这个名字的策略
+var ErrUnknownPolicy = errors.New("未定义的重试策略")
+
+// Duration 可以从 JSON 字符串（如 "100ms"）解析的时间
+type Duration time.Duration
+
+// UnmarshalJSON 解析 "100ms" 这样的字符串
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("时间要写成字符串，比如 \"100ms\": %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("无法解析时间 %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON 输出为 "100ms" 这样的字符串
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// PolicyConfig 配置文件里的一条重试策略
+type PolicyConfig struct {
+	MaxAttempts    int      `json:"max_attempts"`
+	Backoff        string   `json:"backoff"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+	Timeout        Duration `json:"timeout"`
+	AttemptTimeout Duration `json:"attempt_timeout,omitempty"`
+	RetryOn        []string `json:"retry_on,omitempty"`
+}
+
+// PolicyFile 配置文件的整体结构
+type PolicyFile struct {
+	Policies map[string]PolicyConfig `json:"policies"`
+}
+
+// backoffStrategies 配置里的名字 → 退避策略
+var backoffStrategies = map[string]BackoffStrategy{
+	BackoffConstant.String():     BackoffConstant,
+	BackoffLinear.String():       BackoffLinear,
+	BackoffExponential.String():  BackoffExponential,
+	BackoffFullJitter.String():   BackoffFullJitter,
+	BackoffEqualJitter.String():  BackoffEqualJitter,
+	BackoffDecorrelated.String(): BackoffDecorrelated,
+}
+
+// retryableClasses 可以出现在 retry_on 里的错误类别
+var retryableClasses = map[string]ErrorClass{
+	string(ClassTransient): ClassTransient,
+	string(ClassTimeout):   ClassTimeout,
+	string(ClassThrottled): ClassThrottled,
+}
+
+// Validate 检查配置是否合法，返回所有问题（不是只返回第一个）
+func (p PolicyConfig) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	initial, maxBackoff := time.Duration(p.InitialBackoff), time.Duration(p.MaxBackoff)
+	timeout, attemptTimeout := time.Duration(p.Timeout), time.Duration(p.AttemptTimeout)
+
+	if p.MaxAttempts < 1 {
+		add("max_attempts 至少为 1，当前为 %d", p.MaxAttempts)
+	}
+	if _, ok := backoffStrategies[p.Backoff]; !ok {
+		add("未知的 backoff %q", p.Backoff)
+	}
+	if initial <= 0 {
+		add("initial_backoff 必须大于 0，当前为 %v", initial)
+	}
+	if maxBackoff <= 0 {
+		add("max_backoff 必须大于 0，当前为 %v", maxBackoff)
+	}
+	if initial > 0 && maxBackoff > 0 && initial > maxBackoff {
+		add("initial_backoff (%v) 不能大于 max_backoff (%v)", initial, maxBackoff)
+	}
+	if timeout <= 0 {
+		add("timeout 必须大于 0，当前为 %v", timeout)
+	}
+	if attemptTimeout < 0 {
+		add("attempt_timeout 不能为负数，当前为 %v", attemptTimeout)
+	}
+	if timeout > 0 && attemptTimeout > timeout {
+		add("attempt_timeout (%v) 不能大于 timeout (%v)", attemptTimeout, timeout)
+	}
+	if timeout > 0 && initial > 0 && p.MaxAttempts > 1 && timeout <= initial {
+		add("timeout (%v) 不比第一次退避 (%v) 长，永远不会发生重试", timeout, initial)
+	}
+	for _, class := range p.RetryOn {
+		if _, ok := retryableClasses[class]; !ok {
+			add("retry_on 里有无法重试的错误类别 %q（可选: transient、timeout、throttled）", class)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RetryConfig 转换成 Retry 使用的配置（调用前需要先 Validate）
+func (p PolicyConfig) RetryConfig() RetryConfig {
+	config := RetryConfig{
+		MaxRetries:     p.MaxAttempts,
+		InitialBackoff: time.Duration(p.InitialBackoff),
+		MaxBackoff:     time.Duration(p.MaxBackoff),
+		Timeout:        time.Duration(p.Timeout),
+		AttemptTimeout: time.Duration(p.AttemptTimeout),
+		Strategy:       backoffStrategies[p.Backoff],
+	}
+	if p.RetryOn != nil {
+		// 显式写了 "retry_on": [] 就是什么都不重试；不能让它变成 nil，nil 的意思正好相反
+		config.RetryOn = make([]ErrorClass, 0, len(p.RetryOn))
+	}
+	for _, class := range p.RetryOn {
+		config.RetryOn = append(config.RetryOn, retryableClasses[class])
+	}
+	return config
+}
+
+// PolicyRegistry 按名字查找重试策略
+type PolicyRegistry struct {
+	policies map[string]RetryConfig
+}
+
+// ParsePolicies 解析并校验策略配置
+// 任何一条策略有问题都会返回错误，错误里列出所有策略的所有问题
+func ParsePolicies(data []byte) (*PolicyRegistry, error) {
+	var file PolicyFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields() // 字段名写错（比如 "max_retry"）直接报错，而不是悄悄用零值
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("解析重试策略失败: %w", err)
+	}
+	if len(file.Policies) == 0 {
+		return nil, errors.New("配置里没有定义任何重试策略")
+	}
+
+	names := make([]string, 0, len(file.Policies))
+	for name := range file.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names) // 错误按名字排序，每次输出都一样
+
+	registry := &PolicyRegistry{policies: make(map[string]RetryConfig, len(names))}
+	var errs []error
+	for _, name := range names {
+		policy := file.Policies[name]
+		if err := policy.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("策略 %q:\n%w", name, err))
+			continue
+		}
+		registry.policies[name] = policy.RetryConfig()
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return registry, nil
+}
+
+// LoadPolicies 从文件读取重试策略
+func LoadPolicies(path string) (*PolicyRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取重试策略失败: %w", err)
+	}
+	registry, err := ParsePolicies(data)
+	if err != nil {
+		return nil, fmt.Errorf("重试策略 %s 不合法: %w", path, err)
+	}
+	return registry, nil
+}
+
+// Get 按名字取策略
+func (r *PolicyRegistry) Get(name string) (RetryConfig, error) {
+	config, ok := r.policies[name]
+	if !ok {
+		return RetryConfig{}, fmt.Errorf("%w: %q", ErrUnknownPolicy, name)
+	}
+	return config, nil
+}
+
+// Names 返回所有策略的名字（已排序）
+func (r *PolicyRegistry) Names() []string {
+	names := make([]string, 0, len(r.policies))
+	for name := range r.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ============================================
+// 演示: 加载策略，以及写错的配置会怎样报错
+// ============================================
+
+func retryPolicyDemo() {
+	fmt.Println("📍 重试策略配置演示")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	dir, err := os.MkdirTemp("", "retry_policies")
+	if err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good.json")
+	os.WriteFile(good, []byte(`{
+    "policies": {
+        "payment": {
+            "max_attempts": 3, "backoff": "equal-jitter",
+            "initial_backoff": "200ms", "max_backoff": "2s",
+            "timeout": "10s", "attempt_timeout": "3s",
+            "retry_on": ["transient", "timeout"]
+        },
+        "search": {
+            "max_attempts": 5, "backoff": "full-jitter",
+            "initial_backoff": "50ms", "max_backoff": "500ms", "timeout": "2s"
+        }
+    }
+}`), 0o644)
+
+	registry, err := LoadPolicies(good)
+	if err != nil {
+		fmt.Println("  ❌", err)
+		return
+	}
+	for _, name := range registry.Names() {
+		config, _ := registry.Get(name)
+		fmt.Printf("  ✅ %-8s 最多 %d 次，%s，%v ~ %v，总超时 %v\n", name,
+			config.MaxRetries, config.Strategy, config.InitialBackoff, config.MaxBackoff, config.Timeout)
+	}
+	if _, err := registry.Get("checkout"); err != nil {
+		fmt.Println("  ❌", err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{
+    "policies": {
+        "report": {
+            "max_attempts": 3, "backoff": "exponential",
+            "initial_backoff": "5s", "max_backoff": "1s", "timeout": "2s",
+            "retry_on": ["permanent"]
+        }
+    }
+}`), 0o644)
+
+	if _, err := LoadPolicies(bad); err != nil {
+		fmt.Printf("  ❌ %v\n", err)
+	}
+}
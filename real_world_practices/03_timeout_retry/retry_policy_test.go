@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsePoliciesRetryOn(t *testing.T) {
+	registry, err := ParsePolicies([]byte(`{
+    "policies": {
+        "default":  {"max_attempts": 3, "backoff": "constant", "initial_backoff": "1ms", "max_backoff": "1ms", "timeout": "1s"},
+        "none":     {"max_attempts": 3, "backoff": "constant", "initial_backoff": "1ms", "max_backoff": "1ms", "timeout": "1s", "retry_on": []},
+        "timeouts": {"max_attempts": 3, "backoff": "constant", "initial_backoff": "1ms", "max_backoff": "1ms", "timeout": "1s", "retry_on": ["timeout"]}
+    }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy string
+		want   int // 一直返回临时错误时的调用次数
+	}{
+		{"default", 3},  // 不写 retry_on：除了 permanent 都重试
+		{"none", 1},     // retry_on 为空：什么都不重试
+		{"timeouts", 1}, // 只重试超时，临时错误不重试
+	}
+	for _, tt := range tests {
+		config, err := registry.Get(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calls := 0
+		Retry(context.Background(), config, func(ctx context.Context) (string, error) {
+			calls++
+			return "", errors.New("连接被重置")
+		})
+		if calls != tt.want {
+			t.Errorf("策略 %s: 调用了 %d 次，期望 %d 次", tt.policy, calls, tt.want)
+		}
+	}
+}
+
+func TestParsePoliciesReportsAllProblems(t *testing.T) {
+	_, err := ParsePolicies([]byte(`{
+    "policies": {
+        "bad": {"max_attempts": 0, "backoff": "fast", "initial_backoff": "5s", "max_backoff": "1s", "timeout": "2s", "retry_on": ["permanent"]}
+    }
+}`))
+	if err == nil {
+		t.Fatal("不合法的配置应该返回错误")
+	}
+	for _, want := range []string{"max_attempts", "backoff", "initial_backoff (5s) 不能大于 max_backoff (1s)", "permanent"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("错误信息里没有 %q:\n%v", want, err)
+		}
+	}
+
+	if _, err := ParsePolicies([]byte(`{"policies": {"x": {"max_retry": 3}}}`)); err == nil {
+		t.Error("未知字段应该返回错误")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryWithoutMaxRetriesCallsOnce(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	for _, maxRetries := range []int{0, -1} {
+		calls := 0
+		_, history, err := RetryWithHistory(context.Background(), RetryConfig{MaxRetries: maxRetries},
+			func(ctx context.Context) (string, error) {
+				calls++
+				return "", errBoom
+			})
+
+		if calls != 1 {
+			t.Errorf("MaxRetries=%d: operation 被调用了 %d 次，期望 1 次", maxRetries, calls)
+		}
+		if len(history) != 1 {
+			t.Errorf("MaxRetries=%d: 记录了 %d 次尝试，期望 1 次", maxRetries, len(history))
+		}
+		if !errors.Is(err, errBoom) {
+			t.Errorf("MaxRetries=%d: err = %v，期望包含 boom", maxRetries, err)
+		}
+	}
+
+	result, err := Retry(context.Background(), RetryConfig{}, func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+	if err != nil || result != 42 {
+		t.Errorf("零值配置: Retry = (%v, %v)，期望 (42, nil)", result, err)
+	}
+}
+
+func TestRetryStopsOnPermanentError(t *testing.T) {
+	calls := 0
+	_, err := Retry(context.Background(), RetryConfig{MaxRetries: 5, InitialBackoff: time.Millisecond},
+		func(ctx context.Context) (string, error) {
+			calls++
+			return "", Permanent(errors.New("参数错误"))
+		})
+
+	if calls != 1 {
+		t.Errorf("永久错误被重试了：调用 %d 次", calls)
+	}
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 1 {
+		t.Errorf("err = %v，期望只有 1 次尝试的 *RetryError", err)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+🌐 会自动重试的 HTTP 客户端
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+大部分要重试的调用都是 HTTP。把重试做成 http.RoundTripper，
+业务代码照常用 http.Client，重试对它完全透明:
+
+	client := &http.Client{Transport: NewRetryTransport(nil, config)}
+
+什么时候重试:
+- 只重试幂等的方法（GET、HEAD、PUT、DELETE、OPTIONS、TRACE），POST 发两次可能下两个单
+  （带 Idempotency-Key 的 POST / PATCH 除外，服务端会按键去重，见 idempotency.go）
+- 连接错误（连不上、连接被重置）
+- 502 / 503 / 504（网关或服务暂时不可用）和 429（被限流）
+- 响应带 Retry-After 时按它说的等
+
+⚠️ 几个容易忽略的细节:
+1. 请求体是个 io.Reader，第一次发送就读完了 —— 重试前要用 req.GetBody 拿一个新的
+   （http.NewRequest 传入 bytes.Reader / strings.Reader 时会自动设置 GetBody）
+2. 要重试的响应必须把 body 读完并关闭，否则连接不能复用
+3. 最后一次仍然是 503 时，把 503 响应原样返回给调用方，而不是变成一个 error
+4. 单次超时只管到收到响应头为止；返回的响应体在 Close 之前不会被取消
+5. http.Client 会在多个 goroutine 里同时调用 RoundTrip，而 config.Rand 不是并发安全的，
+   所以每个请求从它取一个种子，用自己的随机源（同样的请求顺序结果仍然可以复现）
+*/
+
+// RetryTransport 会自动重试的 http.RoundTripper
+type RetryTransport struct {
+	base   http.RoundTripper
+	config RetryConfig
+
+	randMu sync.Mutex // 保护 config.Rand
+}
+
+// NewRetryTransport 创建重试 Transport，base 为 nil 时使用 http.DefaultTransport
+// config.Timeout 是整个请求（包括读取响应体）的总超时；
+// config.AttemptTimeout 是每次尝试等待响应头的超时
+func NewRetryTransport(base http.RoundTripper, config RetryConfig) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RetryTransport{base: base, config: config}
+}
+
+// requestRand 为一个请求创建独立的随机源，config.Rand 为 nil 时返回 nil（使用全局随机源）
+func (t *RetryTransport) requestRand() *rand.Rand {
+	if t.config.Rand == nil {
+		return nil
+	}
+	t.randMu.Lock()
+	seed := t.config.Rand.Int63()
+	t.randMu.Unlock()
+	return rand.New(rand.NewSource(seed))
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// ctx 里有幂等键时写进请求头，每次重试都带同一个键（RoundTripper 不能修改调用方的请求，先复制一份）
+	if key, ok := IdempotencyKeyFrom(req.Context()); ok && req.Header.Get(IdempotencyKeyHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	if !t.canRetry(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	// 超时由这里自己管理：Retry 返回时会取消它创建的 ctx，那样响应体就读不了了
+	var ctx context.Context
+	var cancelAll context.CancelFunc
+	if t.config.Timeout > 0 {
+		ctx, cancelAll = context.WithTimeout(req.Context(), t.config.Timeout)
+	} else {
+		ctx, cancelAll = context.WithCancel(req.Context())
+	}
+	config := t.config
+	config.Timeout = 0
+	config.AttemptTimeout = 0
+	config.Rand = t.requestRand()
+
+	var pending *http.Response // 最近一次可重试的响应（比如 503），最后一次失败时原样返回
+	discardPending := func() {
+		if pending != nil {
+			drainAndClose(pending.Body)
+			pending = nil
+		}
+	}
+
+	attempt := 0
+	resp, err := Retry(ctx, config, func(ctx context.Context) (*http.Response, error) {
+		discardPending()
+
+		attempt++
+		attemptReq := req.Clone(ctx)
+		if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, Permanent(fmt.Errorf("重置请求体失败: %w", err))
+			}
+			attemptReq.Body = body
+		}
+
+		resp, err := t.send(ctx, attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		if !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		pending = resp
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return nil, RetryAfter(statusErr, delay)
+		}
+		return nil, statusErr
+	})
+
+	if err == nil {
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancelAll}
+		return resp, nil
+	}
+
+	if pending != nil && ctx.Err() == nil {
+		// 不再重试了（次数或预算用完），最后一次是 503 这类响应：原样返回给调用方
+		pending.Body = &cancelOnClose{ReadCloser: pending.Body, cancel: cancelAll}
+		return pending, nil
+	}
+	discardPending()
+	cancelAll()
+	return nil, err
+}
+
+// send 发送一次请求，AttemptTimeout 只限制等待响应头的时间
+func (t *RetryTransport) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if t.config.AttemptTimeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	attemptCtx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(t.config.AttemptTimeout, cancel)
+
+	resp, err := t.base.RoundTrip(req.WithContext(attemptCtx))
+	fired := !timer.Stop()
+	if err != nil {
+		cancel()
+		if fired && ctx.Err() == nil {
+			err = fmt.Errorf("%w (%v): %w", ErrAttemptTimeout, t.config.AttemptTimeout, err)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// canRetry 判断这个请求能不能安全地重发
+func (t *RetryTransport) canRetry(req *http.Request) bool {
+	if !idempotentMethod(req.Method) && req.Header.Get(IdempotencyKeyHeader) == "" {
+		return false
+	}
+	// 有请求体却没法重新获取，第二次就发不出同样的内容了
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	return true
+}
+
+// idempotentMethod 幂等的 HTTP 方法
+func idempotentMethod(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryableStatus 值得重试的状态码
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter 解析 Retry-After 头：秒数或者 HTTP 日期
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := at.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// drainAndClose 读完并关闭响应体，让连接可以复用（最多读 64KB，太大就直接关掉）
+func drainAndClose(body io.ReadCloser) {
+	io.CopyN(io.Discard, body, 64*1024)
+	body.Close()
+}
+
+// cancelOnClose 关闭响应体时释放对应的 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// Close 关闭响应体并取消 context
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.cancel)
+	return err
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetries 测试用的重试配置：退避很短，测试跑得快
+func fastRetries(maxAttempts int) RetryConfig {
+	return RetryConfig{
+		MaxRetries:     maxAttempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Timeout:        10 * time.Second,
+		AttemptTimeout: time.Second,
+	}
+}
+
+// statusServer 按顺序返回 statuses 里的状态码，用完之后一直返回 200
+type statusServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header // 非 200 响应附带的头
+	bodies   [][]byte    // 每次收到的请求体
+}
+
+func newStatusServer(t *testing.T, statuses ...int) *statusServer {
+	s := &statusServer{statuses: statuses, header: http.Header{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		status := http.StatusOK
+		if len(s.bodies) <= len(s.statuses) {
+			status = s.statuses[len(s.bodies)-1]
+		}
+		header := s.header.Clone()
+		s.mu.Unlock()
+
+		if status != http.StatusOK {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(http.StatusText(status)))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// hits 服务端一共收到几次请求
+func (s *statusServer) hits() int {
+	return len(s.requestBodies())
+}
+
+// requestBodies 每次收到的请求体
+func (s *statusServer) requestBodies() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.bodies...)
+}
+
+func TestRetryTransportRetriesRetryableStatuses(t *testing.T) {
+	server := newStatusServer(t, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, http.StatusTooManyRequests)
+	client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(5))}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("状态码 = %d，期望 200", resp.StatusCode)
+	}
+	if got := server.hits(); got != 5 {
+		t.Errorf("服务端收到 %d 次请求，期望 5 次", got)
+	}
+}
+
+func TestRetryTransportDoesNotRetryOtherStatuses(t *testing.T) {
+	server := newStatusServer(t, http.StatusInternalServerError)
+	client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(5))}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError || server.hits() != 1 {
+		t.Errorf("500 应该原样返回、只发一次：状态码 %d，请求 %d 次", resp.StatusCode, server.hits())
+	}
+}
+
+func TestRetryTransportReplaysPutBody(t *testing.T) {
+	server := newStatusServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(5))}
+
+	body := []byte(`{"status":"paid","amount":42}`)
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/orders/42", bytes.NewReader(body))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	bodies := server.requestBodies()
+	if len(bodies) != 3 {
+		t.Fatalf("服务端收到 %d 次请求，期望 3 次", len(bodies))
+	}
+	for i, got := range bodies {
+		if !bytes.Equal(got, body) {
+			t.Errorf("第 %d 次的请求体 = %q，期望 %q", i+1, got, body)
+		}
+	}
+}
+
+func TestRetryTransportPostNeedsIdempotencyKey(t *testing.T) {
+	t.Run("没有幂等键只发一次", func(t *testing.T) {
+		server := newStatusServer(t, http.StatusServiceUnavailable)
+		client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(5))}
+
+		resp, err := client.Post(server.URL, "application/json", bytes.NewReader([]byte(`{"item":"book"}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable || server.hits() != 1 {
+			t.Errorf("POST 被重试了：状态码 %d，请求 %d 次", resp.StatusCode, server.hits())
+		}
+	})
+
+	t.Run("带幂等键可以重试", func(t *testing.T) {
+		var keys []string
+		var mu sync.Mutex
+		var hits int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+			mu.Unlock()
+			if atomic.AddInt64(&hits, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+		client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(5))}
+
+		ctx := WithIdempotencyKey(context.Background(), "order-123")
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, bytes.NewReader([]byte(`{"item":"book"}`)))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || len(keys) != 3 {
+			t.Fatalf("状态码 %d，请求 %d 次，期望重试到 200", resp.StatusCode, len(keys))
+		}
+		for i, key := range keys {
+			if key != "order-123" {
+				t.Errorf("第 %d 次的 %s = %q，期望每次都是 order-123", i+1, IdempotencyKeyHeader, key)
+			}
+		}
+		if req.Header.Get(IdempotencyKeyHeader) != "" {
+			t.Error("RoundTrip 不应该修改调用方的请求")
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second, true},
+		{now.Add(-5 * time.Second).Format(http.TimeFormat), 0, true}, // 已经过去的时间：立即重试
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = (%v, %v)，期望 (%v, %v)", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryTransportHonoursRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value func() string
+	}{
+		{"秒数", func() string { return "1" }},
+		// HTTP 日期只精确到秒，写 2 秒之后，实际要等 1~2 秒
+		{"HTTP 日期", func() string { return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newStatusServer(t, http.StatusTooManyRequests)
+			server.header.Set("Retry-After", tt.value()) // 服务端还没收到请求，不用加锁
+			client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(3))}
+
+			start := time.Now()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("状态码 = %d，期望 200", resp.StatusCode)
+			}
+			if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+				t.Errorf("只等了 %v 就重试了，没有按 Retry-After 等待", elapsed)
+			}
+		})
+	}
+}
+
+func TestRetryTransportStopsWhenContextCancelled(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := fastRetries(1000)
+	config.InitialBackoff, config.MaxBackoff = 10*time.Millisecond, 10*time.Millisecond
+	client := &http.Client{Transport: NewRetryTransport(nil, config)}
+
+	// 用 cancel 而不是 deadline：有 deadline 时，等不到下一次重试就会提前放弃并返回最后的 503
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("取消后应该返回错误，得到 %d", resp.StatusCode)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v，期望 context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("取消后 %v 才返回", elapsed)
+	}
+
+	stoppedAt := atomic.LoadInt64(&hits)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt64(&hits); got != stoppedAt {
+		t.Errorf("返回之后又发了 %d 次请求", got-stoppedAt)
+	}
+}
+
+func TestRetryTransportReturnsFinalResponse(t *testing.T) {
+	server := newStatusServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+		http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	client := &http.Client{Transport: NewRetryTransport(nil, fastRetries(3))}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("最后一次是 503 时应该返回响应而不是错误: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || string(body) != http.StatusText(http.StatusServiceUnavailable) {
+		t.Errorf("响应 = %d %q，期望原样返回 503", resp.StatusCode, body)
+	}
+	if got := server.hits(); got != 3 {
+		t.Errorf("服务端收到 %d 次请求，期望 3 次", got)
+	}
+}
+
+func TestRetryTransportAgainstFlakyServer(t *testing.T) {
+	// 服务端 70% 返回 503，一部分带 Retry-After: 0
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(7))
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		mu.Lock()
+		roll := rng.Float64()
+		mu.Unlock()
+		switch {
+		case roll < 0.1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case roll < 0.7:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	config := fastRetries(20) // 0.7^20 ≈ 0.08%，几乎不会 20 次都失败
+	config.Strategy = BackoffFullJitter
+	config.Rand = rand.New(rand.NewSource(1))
+	client := &http.Client{Transport: NewRetryTransport(nil, config)}
+
+	const requests = 20
+	for i := 0; i < requests; i++ {
+		resp, err := client.Get(server.URL + "/orders/" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("请求 %d: 状态码 %d", i, resp.StatusCode)
+		}
+	}
+	if got := atomic.LoadInt64(&hits); got <= requests {
+		t.Errorf("服务端只收到 %d 次请求，没有发生重试", got)
+	}
+}
+
+func TestRetryTransportConcurrentRequestsShareRand(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 一半的尝试失败，很多请求会同时用随机数算退避
+		if atomic.AddInt64(&hits, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	config := fastRetries(10)
+	config.Strategy = BackoffFullJitter
+	config.Rand = rand.New(rand.NewSource(1)) // 所有请求共用的随机源，go test -race 会发现并发访问
+	client := &http.Client{Transport: NewRetryTransport(nil, config)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Get(server.URL + "/orders/" + strconv.Itoa(i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("请求 %d: 状态码 %d", i, resp.StatusCode)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+/*
+🎰 重试策略模拟器
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+mainT 里跑 5 个请求算成功率，运气好 5/5，运气差 3/5，说明不了任何问题。
+要比较两个策略，至少得跑几千次 —— 真的 sleep 要跑好几个小时。
+
+模拟器把 RetryWithHistory 本身放到"虚拟时钟"上跑：等待不真的 sleep，只是把时钟往前拨。
+每次调用的结果来自 FaultModel.Next()，退避、超时、分类、放弃的判断全是 Retry 自己的代码，
+改了 Retry，模拟结果跟着变，不会出现两套逻辑对不上的情况。
+
+报告里看什么:
+- 成功率:   重试能把多少失败救回来
+- 延迟分位: 救回来的代价，P99 往往被退避和超时拉得很高
+- 放大倍数: 平均每个请求打到下游几次，下游挂掉时它就是额外压力的倍数
+
+⚠️ 不模拟 RetryBudget（它按真实时间补充令牌），也不模拟并发带来的排队。
+*/
+
+// SimulationReport 模拟结果
+type SimulationReport struct {
+	Runs          int
+	Successes     int
+	Hung          int // 没有任何超时、调用又卡住，永远不会返回的请求（不计入延迟分位）
+	TotalAttempts int
+
+	P50, P90, P99, Max time.Duration // 所有会返回的请求（成功和失败）的耗时
+}
+
+// SuccessRate 成功率
+func (r SimulationReport) SuccessRate() float64 {
+	if r.Runs == 0 {
+		return 0
+	}
+	return float64(r.Successes) / float64(r.Runs)
+}
+
+// Amplification 放大倍数：平均每个请求调用了下游几次
+func (r SimulationReport) Amplification() float64 {
+	if r.Runs == 0 {
+		return 0
+	}
+	return float64(r.TotalAttempts) / float64(r.Runs)
+}
+
+// String 一行摘要
+func (r SimulationReport) String() string {
+	s := fmt.Sprintf("成功率 %5.1f%%  P50 %-8v P90 %-8v P99 %-8v 最大 %-8v 放大 %.2fx",
+		r.SuccessRate()*100,
+		r.P50.Round(time.Millisecond), r.P90.Round(time.Millisecond),
+		r.P99.Round(time.Millisecond), r.Max.Round(time.Millisecond),
+		r.Amplification())
+	if r.Hung > 0 {
+		s += fmt.Sprintf("  卡死 %d 次", r.Hung)
+	}
+	return s
+}
+
+// Simulate 在虚拟时钟上把 config 对 model 跑 runs 次
+// seed 决定退避抖动的随机数（config.Rand 为 nil 时），相同的 seed 和 model 结果完全相同
+func Simulate(config RetryConfig, model FaultModel, runs int, seed int64) SimulationReport {
+	if config.Rand == nil {
+		config.Rand = rand.New(rand.NewSource(seed))
+	}
+	config.Budget = nil // 预算按真实时间补充令牌，虚拟时钟上没有意义
+
+	report := SimulationReport{Runs: runs}
+	latencies := make([]time.Duration, 0, runs)
+
+	for i := 0; i < runs; i++ {
+		elapsed, attempts, ok, hung := simulateOne(config, model)
+		report.TotalAttempts += attempts
+		if hung {
+			report.Hung++
+			continue
+		}
+		if ok {
+			report.Successes++
+		}
+		latencies = append(latencies, elapsed)
+	}
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(a, b int) bool { return latencies[a] < latencies[b] })
+		report.P50 = percentile(latencies, 0.50)
+		report.P90 = percentile(latencies, 0.90)
+		report.P99 = percentile(latencies, 0.99)
+		report.Max = latencies[len(latencies)-1]
+	}
+	return report
+}
+
+// errSimulatedHang 调用卡住、又没有任何超时：真实的 Retry 会永远等下去，模拟时直接结束这一次
+var errSimulatedHang = errors.New("调用卡住且没有超时")
+
+// simulateOne 在一个新的虚拟时钟上调用一次 RetryWithHistory
+// operation 从 model 取结果：延迟只是把虚拟时钟往前拨，拨到 ctx 的 deadline 就按超时返回
+func simulateOne(config RetryConfig, model FaultModel) (elapsed time.Duration, attempts int, ok bool, hung bool) {
+	clock := &virtualClock{now: time.Unix(0, 0)}
+	config.clock = clock
+
+	// 卡死不能重试（真实情况下根本回不到 Retry 手里），按永久错误结束
+	classify := config.Classify
+	if classify == nil {
+		classify = DefaultClassifier
+	}
+	config.Classify = func(err error) ErrorClass {
+		if errors.Is(err, errSimulatedHang) {
+			return ClassPermanent
+		}
+		return classify(err)
+	}
+
+	start := clock.Now()
+	_, history, err := RetryWithHistory(context.Background(), config, func(ctx context.Context) (struct{}, error) {
+		fault := model.Next()
+		if fault.Hang {
+			if _, ok := ctx.Deadline(); !ok {
+				return struct{}{}, errSimulatedHang
+			}
+			return struct{}{}, clock.Sleep(ctx, math.MaxInt64) // 一直等到超时
+		}
+		if err := clock.Sleep(ctx, fault.Latency); err != nil {
+			return struct{}{}, err
+		}
+		return struct{}{}, fault.Err
+	})
+
+	if errors.Is(err, errSimulatedHang) {
+		return 0, len(history), false, true
+	}
+	return clock.Now().Sub(start), len(history), err == nil, false
+}
+
+/*
+⏱️ 虚拟时钟
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+只在模拟器里用，一次模拟只有一个 goroutine：
+- Sleep 不真的等，只把 now 往前拨；拨过 ctx 的 deadline 就停在 deadline 上返回超时
+- WithTimeout 返回的 ctx 按虚拟时间判断是否过期
+所以 RetryWithHistory 里的总超时、单次超时、"等不到下一次重试"的判断都照常生效。
+*/
+
+// virtualClock 虚拟时钟（不是并发安全的）
+type virtualClock struct {
+	now time.Time
+}
+
+func (c *virtualClock) Now() time.Time { return c.now }
+
+func (c *virtualClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(c.now) <= d {
+		c.now = deadline
+		return ctx.Err()
+	}
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	return nil
+}
+
+func (c *virtualClock) WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	deadline := c.now.Add(d)
+	if parent, ok := ctx.Deadline(); ok && parent.Before(deadline) {
+		deadline = parent
+	}
+	vc := &virtualContext{Context: ctx, clock: c, deadline: deadline, done: make(chan struct{})}
+	return vc, func() { vc.canceled = true }
+}
+
+// virtualContext 按虚拟时间过期的 context
+// Done 返回的 channel 在调用 Done / Err 时发现已过期才关闭（没有后台 goroutine 去关它）
+type virtualContext struct {
+	context.Context
+	clock    *virtualClock
+	deadline time.Time
+	canceled bool
+	done     chan struct{}
+	closed   bool
+}
+
+func (c *virtualContext) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func (c *virtualContext) Done() <-chan struct{} {
+	c.Err()
+	return c.done
+}
+
+func (c *virtualContext) Err() error {
+	err := c.Context.Err()
+	switch {
+	case err != nil:
+	case c.canceled:
+		err = context.Canceled
+	case !c.clock.now.Before(c.deadline):
+		err = context.DeadlineExceeded
+	}
+	if err != nil && !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return err
+}
+
+// percentile 取已排序切片的分位数
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(q * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// ============================================
+// 演示: 上线前比较几种策略
+// ============================================
+
+func simulatorDemo() {
+	const runs = 10000
+	fmt.Printf("📍 策略模拟: 每个策略跑 %d 次（虚拟时钟，不真的等待）\n", runs)
+	fmt.Println("   故障模型: 30% 返回 503，2% 卡住；延迟 90% 在 20~80ms，10% 在 300ms~1s")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	newModel := func() FaultModel {
+		return NewRandomFaults(RandomFaultConfig{
+			Seed:        1,
+			FailureRate: 0.3,
+			HangRate:    0.02,
+			Latency: LongTailLatency(
+				UniformLatency(20*time.Millisecond, 80*time.Millisecond),
+				UniformLatency(300*time.Millisecond, time.Second),
+				0.1,
+			),
+		})
+	}
+
+	policies := []struct {
+		name   string
+		config RetryConfig
+	}{
+		{"不重试", RetryConfig{MaxRetries: 1, Timeout: 5 * time.Second}},
+		{"指数退避 3 次", RetryConfig{
+			MaxRetries: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second,
+			Timeout: 5 * time.Second,
+		}},
+		{"全抖动 3 次 + 单次超时", RetryConfig{
+			MaxRetries: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second,
+			Timeout: 5 * time.Second, AttemptTimeout: 200 * time.Millisecond, Strategy: BackoffFullJitter,
+		}},
+		{"全抖动 5 次 + 单次超时", RetryConfig{
+			MaxRetries: 5, InitialBackoff: 50 * time.Millisecond, MaxBackoff: 500 * time.Millisecond,
+			Timeout: 2 * time.Second, AttemptTimeout: 200 * time.Millisecond, Strategy: BackoffFullJitter,
+		}},
+	}
+
+	for _, policy := range policies {
+		report := Simulate(policy.config, newModel(), runs, 42)
+		fmt.Printf("  %-22s %v\n", policy.name, report)
+	}
+	fmt.Println("💡 单次超时把卡住的调用变成可重试的失败，P99 从总超时降到 1 秒以内；多试几次成功率更高，代价是放大倍数")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSimulateOneUsesVirtualTime(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable, Message: "服务暂时不可用"}
+	base := RetryConfig{MaxRetries: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	tests := []struct {
+		name         string
+		config       func(c RetryConfig) RetryConfig
+		script       *ScriptedFaults
+		wantElapsed  time.Duration
+		wantAttempts int
+		wantOK       bool
+		wantHung     bool
+	}{
+		{
+			name:         "失败一次后成功",
+			script:       Script(Fail(unavailable).After(10*time.Millisecond), OK().After(10*time.Millisecond)),
+			wantElapsed:  10*time.Millisecond + 100*time.Millisecond + 10*time.Millisecond,
+			wantAttempts: 2, wantOK: true,
+		},
+		{
+			name: "单次超时把卡住变成可重试的失败",
+			config: func(c RetryConfig) RetryConfig {
+				c.AttemptTimeout = 200 * time.Millisecond
+				return c
+			},
+			script:       Script(Hang(), OK().After(10*time.Millisecond)),
+			wantElapsed:  200*time.Millisecond + 100*time.Millisecond + 10*time.Millisecond,
+			wantAttempts: 2, wantOK: true,
+		},
+		{
+			name: "总超时打断慢调用",
+			config: func(c RetryConfig) RetryConfig {
+				c.Timeout = 1500 * time.Millisecond
+				return c
+			},
+			script:       Script(Fail(unavailable).After(time.Second), OK().After(time.Second)),
+			wantElapsed:  1500 * time.Millisecond,
+			wantAttempts: 2,
+		},
+		{
+			name: "等不到下一次重试就放弃",
+			config: func(c RetryConfig) RetryConfig {
+				c.Timeout = 150 * time.Millisecond
+				return c
+			},
+			script:       Script(Fail(unavailable).After(100 * time.Millisecond)),
+			wantElapsed:  100 * time.Millisecond,
+			wantAttempts: 1,
+		},
+		{
+			name:         "永久错误不重试",
+			script:       Script(Fail(&StatusError{StatusCode: http.StatusBadRequest, Message: "参数错误"})),
+			wantAttempts: 1,
+		},
+		{
+			name:         "没有任何超时时卡死",
+			script:       Script(Hang()),
+			wantAttempts: 1, wantHung: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base
+			if tt.config != nil {
+				config = tt.config(config)
+			}
+
+			start := time.Now()
+			elapsed, attempts, ok, hung := simulateOne(config, tt.script)
+			if spent := time.Since(start); spent > 50*time.Millisecond {
+				t.Errorf("模拟花了真实时间 %v，应该几乎不花时间", spent)
+			}
+
+			if elapsed != tt.wantElapsed || attempts != tt.wantAttempts || ok != tt.wantOK || hung != tt.wantHung {
+				t.Errorf("simulateOne = (%v, %d, %v, %v)，期望 (%v, %d, %v, %v)",
+					elapsed, attempts, ok, hung, tt.wantElapsed, tt.wantAttempts, tt.wantOK, tt.wantHung)
+			}
+		})
+	}
+}
+
+// 同一个脚本，真实的 Retry 和模拟器应该走出一样的尝试序列
+func TestSimulateMatchesRealRetry(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable, Message: "服务暂时不可用"}
+	newScript := func() *ScriptedFaults {
+		return Script(
+			Fail(unavailable).After(5*time.Millisecond),
+			Hang(),
+			Fail(ErrConnectionReset),
+			OK().After(5*time.Millisecond),
+		)
+	}
+	config := RetryConfig{
+		MaxRetries:     5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+		Timeout:        time.Second,
+		AttemptTimeout: 30 * time.Millisecond,
+	}
+
+	realScript := newScript()
+	start := time.Now()
+	_, history, err := RetryWithHistory(context.Background(), config, Inject(realScript, func(ctx context.Context) (string, error) {
+		return "ok", nil
+	}))
+	realElapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("真实 Retry 失败: %v", err)
+	}
+
+	report := Simulate(config, newScript(), 1, 1)
+	if report.Successes != 1 || report.TotalAttempts != len(history) {
+		t.Errorf("模拟: 成功 %d 次、尝试 %d 次；真实: 成功、尝试 %d 次", report.Successes, report.TotalAttempts, len(history))
+	}
+
+	// 模拟的耗时是理想值，真实耗时只会因为调度多一点
+	if simulated := report.Max; simulated > realElapsed || realElapsed-simulated > 100*time.Millisecond {
+		t.Errorf("模拟耗时 %v，真实耗时 %v，差得太多", simulated, realElapsed)
+	}
+}
+
+func TestSimulateIsDeterministic(t *testing.T) {
+	newModel := func() FaultModel {
+		return NewRandomFaults(RandomFaultConfig{
+			Seed:        3,
+			FailureRate: 0.4,
+			HangRate:    0.05,
+			Latency:     UniformLatency(10*time.Millisecond, 300*time.Millisecond),
+		})
+	}
+	config := RetryConfig{
+		MaxRetries: 4, InitialBackoff: 50 * time.Millisecond, MaxBackoff: time.Second,
+		Timeout: 2 * time.Second, AttemptTimeout: 200 * time.Millisecond, Strategy: BackoffFullJitter,
+	}
+
+	first := Simulate(config, newModel(), 2000, 42)
+	if second := Simulate(config, newModel(), 2000, 42); first != second {
+		t.Errorf("相同种子两次结果不同:\n  %v\n  %v", first, second)
+	}
+	if first.Hung != 0 {
+		t.Errorf("有单次超时，不应该卡死，实际卡死 %d 次", first.Hung)
+	}
+	if first.Max > config.Timeout {
+		t.Errorf("最大耗时 %v 超过了总超时 %v", first.Max, config.Timeout)
+	}
+}
@@ -0,0 +1,57 @@
+// Package bucket 令牌桶的惰性结算，01_concurrent_downloader 和 02_rate_limiter 共用
+//
+// 两个练习目录都是独立的 main 包，没法互相引用，
+// 所以把"按时间补令牌、算还要等多久"这部分放在这里，各自再包一层锁和等待逻辑。
+package bucket
+
+import "time"
+
+/*
+🪣 惰性结算
+━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+不由后台 goroutine 定时放令牌，而是在每次取令牌时，
+根据距离上次结算过去了多久，一次性补上这段时间应该发放的令牌。
+*/
+
+// State 令牌桶的状态
+// 不是并发安全的，调用方需要自己加锁
+type State struct {
+	Tokens   float64       // 桶里当前的令牌数（小数部分表示"正在攒"的那个令牌）
+	Interval time.Duration // 发放一个令牌的时间间隔
+	Capacity int           // 桶的容量（最多存多少令牌）
+	Last     time.Time     // 上次结算令牌的时间
+}
+
+// New 创建一个装满令牌的桶
+func New(interval time.Duration, capacity int, now time.Time) State {
+	return State{
+		Tokens:   float64(capacity),
+		Interval: interval,
+		Capacity: capacity,
+		Last:     now,
+	}
+}
+
+// Refill 结算从上次到 now 应该发放的令牌
+// now 早于上次结算时间（比如时钟回拨）时什么也不做
+func (s *State) Refill(now time.Time) {
+	elapsed := now.Sub(s.Last)
+	if elapsed <= 0 {
+		return
+	}
+	s.Tokens += float64(elapsed) / float64(s.Interval)
+	if s.Tokens > float64(s.Capacity) {
+		s.Tokens = float64(s.Capacity) // 桶满了，多出来的令牌丢弃
+	}
+	s.Last = now
+}
+
+// Delay 计算攒够 n 个令牌还需要多久（已经够了返回 0）
+func (s *State) Delay(n int) time.Duration {
+	missing := float64(n) - s.Tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing * float64(s.Interval))
+}
@@ -0,0 +1,51 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"按间隔补令牌", 0, 250 * time.Millisecond, 2.5},
+		{"补满为止", 1, time.Hour, 4},
+		{"时钟回拨不扣令牌", 3, -time.Second, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(100*time.Millisecond, 4, start)
+			s.Tokens = tt.tokens
+			s.Refill(start.Add(tt.elapsed))
+			if s.Tokens != tt.want {
+				t.Errorf("Tokens = %v，期望 %v", s.Tokens, tt.want)
+			}
+			if tt.elapsed < 0 && !s.Last.Equal(start) {
+				t.Errorf("时钟回拨后 Last = %v，期望保持 %v", s.Last, start)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	s := New(100*time.Millisecond, 4, time.Now())
+	s.Tokens = 1.5
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 0},
+		{2, 50 * time.Millisecond},
+		{4, 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := s.Delay(tt.n); got != tt.want {
+			t.Errorf("Delay(%d) = %v，期望 %v", tt.n, got, tt.want)
+		}
+	}
+}